@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"rdmirrorsync/internal/logging"
+)
+
+// cmdApprove lists delete plans awaiting approval, or approves the plan with
+// the given ID. It works on the state directory directly, so the daemon picks
+// the approval up on the destination's next run.
+func cmdApprove(args []string) int {
+	fs, configPath := newFlagSet("approve")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rd-mirror-sync approve [flags] [plan-id]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	store := newApprovalStore(cfg)
+
+	if fs.NArg() == 1 {
+		rec, err := store.Approve(fs.Arg(0))
+		if err != nil {
+			slog.Error("approve failed", "plan_id", fs.Arg(0), logging.Err(err))
+			return 1
+		}
+		fmt.Printf("approved plan %s for %s: %d deletes will run on the next sync\n", rec.ID, rec.Dest, len(rec.Deletes))
+		return 0
+	}
+
+	recs, err := store.List()
+	if err != nil {
+		slog.Error("list approvals failed", logging.Err(err))
+		return 1
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDEST\tSTATUS\tDELETES\tCREATED")
+	for _, r := range recs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", r.ID, r.Dest, r.Status, len(r.Deletes), formatTime(r.CreatedAt))
+	}
+	tw.Flush()
+	return 0
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"rdmirrorsync/internal/audit"
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/syncer"
+)
+
+// cmdAudit prints matching entries from the audit log, oldest first.
+func cmdAudit(args []string) int {
+	fs, configPath := newFlagSet("audit")
+	dest := fs.String("dest", "", "only this destination")
+	hash := fs.String("hash", "", "only this torrent hash")
+	action := fs.String("action", "", "only add or delete")
+	since := fs.Duration("since", 0, "only entries newer than this, e.g. 72h")
+	limit := fs.Int("limit", 100, "show at most this many of the newest matches (0 = all)")
+	raw := fs.Bool("json", false, "print JSON lines instead of a table")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *action != "" && *action != syncer.ActionAdd && *action != syncer.ActionDelete {
+		fmt.Fprintf(os.Stderr, "invalid -action %q (expected add or delete)\n", *action)
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	if cfg.AuditLog == "" {
+		slog.Error("audit_log is disabled in the config")
+		return 2
+	}
+
+	f := audit.Filter{Dest: *dest, Hash: *hash, Action: *action, Limit: *limit}
+	if *since > 0 {
+		f.Since = time.Now().Add(-*since)
+	}
+	events, err := audit.Read(cfg.AuditLog, f)
+	if err != nil {
+		slog.Error("read audit log failed", "path", cfg.AuditLog, logging.Err(err))
+		return 1
+	}
+
+	if *raw {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range events {
+			_ = enc.Encode(e)
+		}
+		return 0
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tDEST\tACTION\tHASH\tID\tREASON\tERROR\tNAME")
+	for _, e := range events {
+		errText := e.Error
+		if errText == "" {
+			errText = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			formatTime(e.Time), e.Dest, e.Action, e.Hash, e.TorrentID, e.Reason, errText, e.Name)
+	}
+	tw.Flush()
+	return 0
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/syncer"
+)
+
+// cmdDiff prints the adds and deletes each destination's next run would make,
+// without writing anything. -mode previews a different mode, and -against
+// compares against a plan saved by an earlier run.
+func cmdDiff(args []string) int {
+	fs, configPath := newFlagSet("diff")
+	dest := fs.String("dest", "", "only diff this destination")
+	format := fs.String("format", "table", "output format: table, json or csv")
+	mode := fs.String("mode", "", "preview with this mode instead of the configured one (add-only or mirror-delete)")
+	against := fs.String("against", "", "JSON plan file to compare against (requires -dest); prints only what changed")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	switch *format {
+	case "table", "json", "csv":
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -format %q (expected table, json or csv)\n", *format)
+		return 2
+	}
+	if *mode != "" && syncer.Mode(*mode) != syncer.ModeAddOnly && syncer.Mode(*mode) != syncer.ModeMirrorDelete {
+		fmt.Fprintf(os.Stderr, "invalid -mode %q (expected add-only or mirror-delete)\n", *mode)
+		return 2
+	}
+	if *against != "" && *dest == "" {
+		fmt.Fprintln(os.Stderr, "-against requires -dest")
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	dsts, err := selectDestinations(cfg, *dest)
+	if err != nil {
+		slog.Error(err.Error())
+		return 2
+	}
+
+	var prev syncer.Plan
+	if *against != "" {
+		f, err := os.Open(*against)
+		if err != nil {
+			slog.Error("open plan failed", logging.Err(err))
+			return 1
+		}
+		prev, err = syncer.ReadPlanJSON(f)
+		f.Close()
+		if err != nil {
+			slog.Error("read plan failed", "path", *against, logging.Err(err))
+			return 1
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	api := newAPI(cfg, nil, nil)
+	plans := make([]syncer.Plan, 0, len(dsts))
+	for _, dst := range dsts {
+		if *mode != "" {
+			dst.Mode = syncer.Mode(*mode)
+		}
+		runCtx, cancel := runContext(ctx, cfg)
+		plan, _, err := newRunner(api, cfg, dst, runnerDeps{failures: newFailureStore(cfg), lists: newListStore(cfg)}).Plan(runCtx)
+		cancel()
+		if err != nil {
+			slog.Error("diff failed", logging.KeyDest, dst.Name, logging.Err(err))
+			return 1
+		}
+		plans = append(plans, plan)
+	}
+
+	if *against != "" {
+		return printPlanDiff(syncer.DiffPlans(prev, plans[0]), *format)
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(plans)
+	case "csv":
+		err = syncer.WritePlansCSV(os.Stdout, plans)
+	default:
+		err = printPlanTable(plans)
+	}
+	if err != nil {
+		slog.Error("write diff failed", logging.Err(err))
+		return 1
+	}
+	return 0
+}
+
+func printPlanTable(plans []syncer.Plan) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEST\tACTION\tHASH\tID\tNAME\tREASON")
+	for _, p := range plans {
+		for _, r := range p.Rows() {
+			if r.Action == syncer.ActionSkipped {
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Dest, r.Action, r.Hash, rowID(r), r.Name, r.Reason)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, p := range plans {
+		fmt.Printf("%s: %d to add, %d to delete, %d protected, %d skipped (mode=%s)\n",
+			p.Dest, len(p.Adds), len(p.Deletes), len(p.Protected), len(p.Skipped), p.Mode)
+	}
+	return nil
+}
+
+func printPlanDiff(d syncer.PlanDiff, format string) int {
+	var err error
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(d)
+	default:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHANGE\tACTION\tHASH\tID\tNAME\tREASON")
+		for _, r := range d.New {
+			fmt.Fprintf(tw, "+\t%s\t%s\t%s\t%s\t%s\n", r.Action, r.Hash, rowID(r), r.Name, r.Reason)
+		}
+		for _, r := range d.Gone {
+			fmt.Fprintf(tw, "-\t%s\t%s\t%s\t%s\t%s\n", r.Action, r.Hash, rowID(r), r.Name, r.Reason)
+		}
+		err = tw.Flush()
+	}
+	if err != nil {
+		slog.Error("write diff failed", logging.Err(err))
+		return 1
+	}
+	return 0
+}
+
+// rowID returns the torrent ID relevant to the row: the source ID for adds,
+// the destination ID otherwise.
+func rowID(r syncer.PlanRow) string {
+	if r.Action == syncer.ActionAdd || r.DestID == "" {
+		return r.SourceID
+	}
+	return r.DestID
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"rdmirrorsync/internal/config"
+)
+
+// healthcheckPaths maps -check values to health server endpoints.
+var healthcheckPaths = map[string]string{
+	"live":   "/livez",
+	"ready":  "/readyz",
+	"health": "/healthz",
+}
+
+// cmdHealthcheck probes a running daemon and exits 0 when the check passes,
+// 1 otherwise. It prints nothing on success, so it suits a Dockerfile
+// HEALTHCHECK in images without curl.
+func cmdHealthcheck(args []string) int {
+	fs, configPath := newFlagSet("healthcheck")
+	check := fs.String("check", "live", "endpoint to probe: live, ready or health")
+	baseURL := fs.String("url", "", "daemon base URL (default derived from health_addr)")
+	insecure := fs.Bool("insecure", false, "skip TLS certificate verification")
+	timeout := fs.Duration("timeout", 3*time.Second, "request timeout")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	path, ok := healthcheckPaths[*check]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invalid -check %q (expected live, ready or health)\n", *check)
+		return 2
+	}
+
+	var cfg config.Config
+	if *baseURL == "" {
+		var err error
+		cfg, err = loadConfig(*configPath)
+		if err != nil {
+			slog.Error(err.Error())
+			return 1
+		}
+		if cfg.HealthAddr == "" {
+			slog.Error("health_addr is not set in the config; pass -url")
+			return 2
+		}
+	}
+
+	client, base := healthClient(cfg, *baseURL, *timeout, *insecure)
+	req, err := http.NewRequest(http.MethodGet, base+path, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	setHealthAuth(req, cfg)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s%s\n", path, resp.Status, probeReasons(resp.Body))
+	return 1
+}
+
+// probeReasons summarises the failing destinations of a /livez, /readyz or
+// /healthz response, e.g. " (a: waiting for first run)".
+func probeReasons(r io.Reader) string {
+	var body struct {
+		Destinations map[string]struct {
+			Reason string `json:"reason"`
+		} `json:"destinations"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r, 1<<20)).Decode(&body); err != nil {
+		return ""
+	}
+	var reasons []string
+	for n, d := range body.Destinations {
+		if d.Reason != "" {
+			reasons = append(reasons, n+": "+d.Reason)
+		}
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+	sort.Strings(reasons)
+	return " (" + strings.Join(reasons, "; ") + ")"
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"rdmirrorsync/internal/lists"
+	"rdmirrorsync/internal/logging"
+)
+
+// cmdListEdit returns the command for the ignore or pin list: without
+// arguments it prints the list, with hashes it adds them (or removes them
+// with -remove). It edits the state directory directly, so the daemon picks
+// changes up on the destination's next run.
+func cmdListEdit(list string) func(args []string) int {
+	return func(args []string) int {
+		fs, configPath := newFlagSet(list)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: rd-mirror-sync %s [flags] [hash...]\n", list)
+			fs.PrintDefaults()
+		}
+		dest := fs.String("dest", "", "destination; required to add or remove, otherwise only list this one")
+		remove := fs.Bool("remove", false, "remove the hashes instead of adding them")
+		note := fs.String("note", "", "note stored with added hashes")
+		if code := parseFlags(fs, args); code >= 0 {
+			return code
+		}
+
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			slog.Error(err.Error())
+			return 1
+		}
+		dsts, err := selectDestinations(cfg, *dest)
+		if err != nil {
+			slog.Error(err.Error())
+			return 2
+		}
+		store := newListStore(cfg)
+
+		if fs.NArg() > 0 {
+			if *dest == "" {
+				fmt.Fprintf(os.Stderr, "%s: -dest is required to change the list\n", list)
+				return 2
+			}
+			for _, h := range fs.Args() {
+				var changed bool
+				if *remove {
+					changed, err = store.Remove(*dest, list, h)
+				} else {
+					changed, err = store.Add(*dest, list, h, *note)
+				}
+				if err != nil {
+					slog.Error("update "+list+" list failed", logging.KeyDest, *dest, logging.KeyHash, h, logging.Err(err))
+					return 1
+				}
+				switch {
+				case *remove && changed:
+					fmt.Printf("%s: removed %s from the %s list\n", *dest, h, list)
+				case *remove:
+					fmt.Printf("%s: %s was not on the %s list\n", *dest, h, list)
+				case changed:
+					fmt.Printf("%s: added %s to the %s list\n", *dest, h, list)
+				default:
+					fmt.Printf("%s: %s is already on the %s list\n", *dest, h, list)
+				}
+			}
+			return 0
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "DEST\tHASH\tADDED\tNOTE")
+		for _, d := range dsts {
+			l, err := store.Get(d.Name)
+			if err != nil {
+				slog.Error("read "+list+" list failed", logging.KeyDest, d.Name, logging.Err(err))
+				return 1
+			}
+			entries := l.Ignore
+			if list == lists.Pin {
+				entries = l.Pin
+			}
+			for _, e := range entries {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.Name, e.Hash, formatTime(e.AddedAt), e.Note)
+			}
+		}
+		tw.Flush()
+		return 0
+	}
+}
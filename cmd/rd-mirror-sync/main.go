@@ -2,113 +2,349 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
-	"os/signal"
-	"sync"
-	"syscall"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"rdmirrorsync/internal/approval"
+	"rdmirrorsync/internal/audit"
 	"rdmirrorsync/internal/config"
+	"rdmirrorsync/internal/failures"
+	"rdmirrorsync/internal/lists"
+	"rdmirrorsync/internal/lock"
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/notify"
 	"rdmirrorsync/internal/rdapi"
-	"rdmirrorsync/internal/status"
 	"rdmirrorsync/internal/syncer"
+	"rdmirrorsync/internal/tracing"
 )
 
+const usage = `Usage: rd-mirror-sync [command] [flags]
+
+Commands:
+  run          Start the sync daemon (default when no command is given)
+  once         Run a single sync pass and exit non-zero on any failure
+  diff         Print the pending add/delete plan without writing
+  status       Query a running daemon's /healthz endpoint
+  healthcheck  Exit 0 if a running daemon is live (or ready/healthy); for container HEALTHCHECKs
+  validate     Check the config file and exit
+  approve      List delete plans awaiting approval, or approve one by ID
+  audit        Search the audit log of adds and deletes
+  quarantine   List hashes whose adds keep failing, or clear them for a retry
+  ignore       List, add or remove hashes never to add to a destination
+  pin          List, add or remove hashes never to delete from a destination
+  notify-test  Send a test notification to every configured notifier
+
+Run "rd-mirror-sync <command> -h" for command flags.
+`
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+var commands = map[string]func(args []string) int{
+	"run":         cmdRun,
+	"once":        cmdOnce,
+	"diff":        cmdDiff,
+	"status":      cmdStatus,
+	"healthcheck": cmdHealthcheck,
+	"validate":    cmdValidate,
+	"approve":     cmdApprove,
+	"audit":       cmdAudit,
+	"quarantine":  cmdQuarantine,
+	"ignore":      cmdListEdit(lists.Ignore),
+	"pin":         cmdListEdit(lists.Pin),
+	"notify-test": cmdNotifyTest,
+}
+
 func main() {
-	cfg, err := config.Load()
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			fmt.Fprint(os.Stdout, usage)
+			return
+		}
+	}
+
+	// No command (or only flags) keeps the original behaviour of starting the
+	// daemon, so existing systemd units keep working.
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+	os.Exit(cmd(args))
+}
+
+// newFlagSet returns a FlagSet for a subcommand with the shared -config flag.
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("rd-mirror-sync "+name, flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to config file (default $CONFIG_FILE or ./config.json)")
+	return fs, configPath
+}
+
+// loadConfig loads the config from path, falling back to config.Path when
+// path is empty, and installs the configured logger as the slog default.
+func loadConfig(path string) (config.Config, error) {
+	if path == "" {
+		path = config.Path()
+	}
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("config error: %w (expected a JSON config file at ./config.json or a path set via CONFIG_FILE or -config)", err)
+	}
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
-		log.Fatalf("config error: %v (expected a JSON config file at ./config.json or a path set via CONFIG_FILE)", err)
+		return config.Config{}, err
 	}
+	slog.SetDefault(logger)
+	return cfg, nil
+}
 
-	api := rdapi.NewClient(rdapi.ClientConfig{
+// destLogger returns the default logger with the dest attribute set.
+func destLogger(name string) *slog.Logger {
+	return slog.With(logging.KeyDest, name)
+}
+
+// selectDestinations returns all destinations, or only the one named dest.
+func selectDestinations(cfg config.Config, dest string) ([]config.Destination, error) {
+	if dest == "" {
+		return cfg.Destinations, nil
+	}
+	for _, d := range cfg.Destinations {
+		if d.Name == dest {
+			return []config.Destination{d}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown or disabled destination %q", dest)
+}
+
+// newAPI builds the RD client. obs and tracer may be nil.
+func newAPI(cfg config.Config, obs rdapi.Observer, tracer *tracing.Tracer) *rdapi.Client {
+	return rdapi.NewClient(rdapi.ClientConfig{
 		BaseURL:        cfg.BaseURL,
 		HTTPTimeout:    cfg.HTTPTimeout,
 		MaxRetries:     cfg.MaxRetries,
 		RetryBase:      cfg.RetryBase,
 		RetryMaxJitter: cfg.RetryMaxJitter,
 		PageLimit:      cfg.PageLimit,
+		Observer:       obs,
+		Tracer:         tracer,
 	})
+}
 
-	names := make([]string, len(cfg.Destinations))
-	for i, d := range cfg.Destinations {
-		names[i] = d.Name
+// newTracer returns a tracer exporting to cfg.OTLPEndpoint, or nil when
+// tracing is not configured.
+func newTracer(cfg config.Config) *tracing.Tracer {
+	if cfg.OTLPEndpoint == "" {
+		return nil
+	}
+	exp, err := tracing.NewOTLPExporter(cfg.OTLPEndpoint, cfg.OTLPHeaders,
+		tracing.String("service.name", "rd-mirror-sync"), tracing.String("service.version", version))
+	if err != nil {
+		// Validated when the config was loaded.
+		slog.Error("tracing disabled", logging.Err(err))
+		return nil
 	}
-	ms := status.NewMultiState(names, cfg.Interval)
+	slog.Info("exporting traces", "endpoint", cfg.OTLPEndpoint)
+	return tracing.NewTracer(exp)
+}
 
-	if cfg.HealthAddr != "" {
-		go func() {
-			log.Printf("health server listening on %s", cfg.HealthAddr)
-			if err := http.ListenAndServe(cfg.HealthAddr, ms.Handler()); err != nil {
-				log.Printf("health server stopped: %v", err)
-			}
-		}()
-	}
-
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
-
-	var wg sync.WaitGroup
-	for _, dst := range cfg.Destinations {
-		wg.Add(1)
-		go func(dst config.Destination) {
-			defer wg.Done()
-
-			runner := syncer.NewRunner(api, syncer.RunnerConfig{
-				SrcToken:        cfg.SrcToken,
-				DstToken:        dst.Token,
-				Mode:            dst.Mode,
-				DryRun:          dst.DryRun,
-				WriteDelay:      cfg.WriteDelay,
-				ProtectDstRegex: dst.ProtectDstRegex,
-			})
-
-			st := ms.For(dst.Name)
-
-			runOnce := func() {
-				st.MarkStart()
-				runCtx := ctx
-				var cancel context.CancelFunc
-				if cfg.RunTimeout > 0 {
-					runCtx, cancel = context.WithTimeout(ctx, cfg.RunTimeout)
-				} else {
-					runCtx, cancel = context.WithCancel(ctx)
-				}
-				defer cancel()
-
-				stats, err := runner.RunOnce(runCtx)
-				st.MarkResult(stats, err)
-				if err != nil {
-					log.Printf("[%s] sync error: %v", dst.Name, err)
-					return
-				}
-				elapsed := stats.FinishedAt.Sub(stats.StartedAt).Round(time.Millisecond)
-				log.Printf(
-					"[%s] sync done src=%d dst=%d need_add=%d need_delete=%d added=%d deleted=%d add_errors=%d delete_errors=%d elapsed=%s",
-					dst.Name, stats.SourceCount, stats.DestCount,
-					stats.NeedAdd, stats.NeedDelete, stats.Added, stats.Deleted,
-					stats.AddErrors, stats.DeleteErrors, elapsed,
-				)
-			}
+// shutdownTracer flushes buffered spans before exit.
+func shutdownTracer(tracer *tracing.Tracer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		slog.Warn("flush traces failed", logging.Err(err))
+	}
+}
 
-			log.Printf("[%s] starting (mode=%s dry_run=%v)", dst.Name, dst.Mode, dst.DryRun)
-			runOnce()
+// runnerDeps are the shared services runners use. Any of them may be nil,
+// e.g. when a runner is only used for planning.
+type runnerDeps struct {
+	approvals *approval.Store
+	failures  *failures.Store
+	lists     *lists.Store
+	tracer    *tracing.Tracer
+	audit     *audit.Log
+}
 
-			ticker := time.NewTicker(cfg.Interval)
-			defer ticker.Stop()
+// newRunner builds the runner for dst.
+func newRunner(api syncer.API, cfg config.Config, dst config.Destination, deps runnerDeps) *syncer.Runner {
+	rc := syncer.RunnerConfig{
+		Name:            dst.Name,
+		SrcToken:        cfg.SrcToken,
+		DstToken:        dst.Token,
+		Mode:            dst.Mode,
+		DryRun:          dst.DryRun,
+		WriteDelay:      cfg.WriteDelay,
+		DrainTimeout:    cfg.DrainTimeout,
+		FullReconcile:   cfg.FullReconcile,
+		ProtectDstRegex: dst.ProtectDstRegex,
+		Dedupe:          dst.Dedupe,
+		Tracer:          deps.tracer,
+		Logger:          destLogger(dst.Name),
+	}
+	if dst.DeleteApproval && deps.approvals != nil {
+		rc.DeleteGate = approval.NewGate(deps.approvals, dst.Name, dst.DeleteApprovalOver)
+	}
+	if deps.audit != nil {
+		rc.Auditor = deps.audit
+	}
+	if deps.failures != nil {
+		rc.Failures = failures.NewTracker(deps.failures, dst.Name, failures.Policy{
+			Backoff:         cfg.FailureBackoff,
+			MaxBackoff:      cfg.FailureBackoffMax,
+			QuarantineAfter: cfg.QuarantineAfter,
+		})
+	}
+	if deps.lists != nil {
+		rc.Lists = lists.NewSource(deps.lists, dst.Name)
+	}
+	return syncer.NewRunner(api, rc)
+}
+
+// openAuditLog opens cfg.AuditLog, returning nil when it is disabled.
+func openAuditLog(cfg config.Config) (*audit.Log, error) {
+	if cfg.AuditLog == "" {
+		return nil, nil
+	}
+	return audit.Open(cfg.AuditLog)
+}
+
+// newNotifier builds the notifier for cfg.Notifiers, or nil when none are
+// configured.
+func newNotifier(cfg config.Config) (*notify.Notifier, error) {
+	if len(cfg.Notifiers) == 0 {
+		return nil, nil
+	}
+	client := &http.Client{Timeout: cfg.HTTPTimeout}
+	routes := make([]notify.Route, 0, len(cfg.Notifiers))
+	for _, nc := range cfg.Notifiers {
+		sink, err := notify.NewSink(nc, client)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, notify.Route{Sink: sink, Kinds: nc.Kinds})
+	}
+	return notify.New(routes, cfg.NotifyMinInterval), nil
+}
+
+// closeNotifier waits briefly for queued notifications to go out.
+func closeNotifier(n *notify.Notifier) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := n.Close(ctx); err != nil {
+		slog.Warn("pending notifications not sent", logging.Err(err))
+	}
+}
+
+func newApprovalStore(cfg config.Config) *approval.Store {
+	return approval.NewStore(filepath.Join(cfg.StateDir, "approvals"))
+}
+
+func newFailureStore(cfg config.Config) *failures.Store {
+	return failures.NewStore(filepath.Join(cfg.StateDir, "failures"))
+}
+
+func newListStore(cfg config.Config) *lists.Store {
+	return lists.NewStore(filepath.Join(cfg.StateDir, "lists"))
+}
 
-			for {
-				select {
-				case <-ctx.Done():
-					log.Printf("[%s] shutdown signal received; exiting", dst.Name)
-					return
-				case <-ticker.C:
-					runOnce()
-				}
+// lockDestinations takes the single-instance lock of each destination. If
+// one is held elsewhere, those already taken are released again. The
+// returned func releases them all.
+func lockDestinations(cfg config.Config, dsts []config.Destination) (func(), error) {
+	dir := filepath.Join(cfg.StateDir, "locks")
+	locks := make([]*lock.Lock, 0, len(dsts))
+	release := func() {
+		for _, l := range locks {
+			if err := l.Release(); err != nil {
+				slog.Warn("release lock failed", "path", l.Path(), logging.Err(err))
 			}
-		}(dst)
+		}
+	}
+	for _, d := range dsts {
+		l, err := lock.Acquire(dir, d.Name, d.Token)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("destination %q: %w", d.Name, err)
+		}
+		locks = append(locks, l)
+	}
+	return release, nil
+}
+
+// runContext derives the per-run context, bounded by cfg.RunTimeout when set.
+func runContext(ctx context.Context, cfg config.Config) (context.Context, context.CancelFunc) {
+	if cfg.RunTimeout > 0 {
+		return context.WithTimeout(ctx, cfg.RunTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// logRunResult logs the outcome of a single RunOnce on l, the destination's
+// logger. Runs with add or delete errors log at warn level.
+func logRunResult(l *slog.Logger, stats syncer.Stats, err error) {
+	if errors.Is(err, syncer.ErrInterrupted) {
+		l.Warn("sync interrupted", logging.KeyOp, "sync",
+			"need_add", stats.NeedAdd, "need_delete", stats.NeedDelete,
+			"added", stats.Added, "deleted", stats.Deleted,
+			"add_errors", stats.AddErrors, "delete_errors", stats.DeleteErrors,
+			logging.Err(err))
+		return
+	}
+	if err != nil {
+		l.Error("sync failed", logging.KeyOp, "sync", logging.Err(err))
+		return
+	}
+	level := slog.LevelInfo
+	if stats.AddErrors > 0 || stats.DeleteErrors > 0 || stats.IncompleteListing {
+		level = slog.LevelWarn
 	}
+	l.Log(context.Background(), level, "sync done", logging.KeyOp, "sync",
+		"src", stats.SourceCount, "dst", stats.DestCount, "dest_cached", stats.DestCached,
+		"need_add", stats.NeedAdd, "need_delete", stats.NeedDelete,
+		"added", stats.Added, "resumed", stats.Resumed, "deleted", stats.Deleted,
+		"duplicates", stats.Duplicates, "deduped", stats.Deduped,
+		"add_errors", stats.AddErrors, "delete_errors", stats.DeleteErrors,
+		"incomplete_listing", stats.IncompleteListing,
+		"elapsed", stats.FinishedAt.Sub(stats.StartedAt).Round(time.Millisecond))
+}
 
-	wg.Wait()
+// savePlan writes the plan to cfg.PlanDir when plan export is enabled.
+func savePlan(cfg config.Config, plan syncer.Plan) {
+	if cfg.PlanDir == "" {
+		return
+	}
+	if err := syncer.SavePlan(cfg.PlanDir, cfg.PlanFormat, plan); err != nil {
+		destLogger(plan.Dest).Error("save plan failed", logging.Err(err))
+	}
+}
+
+// parseFlags parses args into fs and maps the result to an exit code: -1 to
+// continue, 0 for -h, 2 for a usage error.
+func parseFlags(fs *flag.FlagSet, args []string) int {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+	return -1
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/notify"
+)
+
+// cmdNotifyTest sends a test event straight to every configured notifier
+// (or just -name) and exits non-zero if any of them failed.
+func cmdNotifyTest(args []string) int {
+	fs, configPath := newFlagSet("notify-test")
+	name := fs.String("name", "", "only this notifier")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	if *name != "" {
+		var only []notify.SinkConfig
+		for _, nc := range cfg.Notifiers {
+			if nc.Name == *name {
+				only = append(only, nc)
+			}
+		}
+		if len(only) == 0 {
+			slog.Error("unknown notifier", "name", *name)
+			return 2
+		}
+		cfg.Notifiers = only
+	}
+	n, err := newNotifier(cfg)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	if n == nil {
+		slog.Error("no notifiers configured")
+		return 2
+	}
+	defer closeNotifier(n)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = n.SendNow(ctx, notify.Event{
+		Kind:     notify.KindTest,
+		Severity: notify.SeverityInfo,
+		Title:    "rd-mirror-sync: test notification",
+		Message:  "If you can read this, notifications from rd-mirror-sync reach this channel.",
+	})
+	if err != nil {
+		slog.Error("test notification failed", logging.Err(err))
+		return 1
+	}
+	fmt.Printf("sent test notification to %d notifier(s)\n", len(cfg.Notifiers))
+	return 0
+}
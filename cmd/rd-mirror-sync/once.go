@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"rdmirrorsync/internal/config"
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/syncer"
+)
+
+// cmdOnce runs a single sync pass for every destination (or just -dest) and
+// exits non-zero if any run failed or had add/delete errors.
+func cmdOnce(args []string) int {
+	fs, configPath := newFlagSet("once")
+	dest := fs.String("dest", "", "only sync this destination")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	dsts, err := selectDestinations(cfg, *dest)
+	if err != nil {
+		slog.Error(err.Error())
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tracer := newTracer(cfg)
+	defer shutdownTracer(tracer)
+	api := newAPI(cfg, nil, tracer)
+	auditLog, err := openAuditLog(cfg)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	if auditLog != nil {
+		defer auditLog.Close()
+	}
+	deps := runnerDeps{approvals: newApprovalStore(cfg), failures: newFailureStore(cfg), lists: newListStore(cfg), tracer: tracer, audit: auditLog}
+	code := 0
+	for _, dst := range dsts {
+		if ctx.Err() != nil {
+			slog.Warn("skipped", logging.KeyDest, dst.Name, logging.Err(ctx.Err()))
+			code = 1
+			continue
+		}
+
+		unlock, err := lockDestinations(cfg, []config.Destination{dst})
+		if err != nil {
+			slog.Error("skipped: another instance is syncing", logging.KeyDest, dst.Name, logging.Err(err))
+			code = 1
+			continue
+		}
+		runner := newRunner(api, cfg, dst, deps)
+		runCtx, cancel := runContext(ctx, cfg)
+		stats, err := runner.RunOnce(runCtx)
+		cancel()
+		unlock()
+		if err == nil || errors.Is(err, syncer.ErrInterrupted) {
+			savePlan(cfg, runner.LastPlan())
+		}
+
+		logRunResult(destLogger(dst.Name), stats, err)
+		if err != nil || stats.AddErrors > 0 || stats.DeleteErrors > 0 {
+			code = 1
+		}
+	}
+	return code
+}
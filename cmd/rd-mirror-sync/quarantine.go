@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"rdmirrorsync/internal/logging"
+)
+
+// cmdQuarantine lists hashes whose adds keep failing, or clears them so the
+// next run tries again. Like approve it works on the state directory
+// directly, so the daemon picks changes up on the destination's next run.
+func cmdQuarantine(args []string) int {
+	fs, configPath := newFlagSet("quarantine")
+	dest := fs.String("dest", "", "only this destination")
+	all := fs.Bool("all", false, "also list hashes still backing off, not only quarantined ones")
+	clearHash := fs.String("clear", "", `forget the failures of this hash ("all" for every hash) so it is retried`)
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	dsts, err := selectDestinations(cfg, *dest)
+	if err != nil {
+		slog.Error(err.Error())
+		return 2
+	}
+	store := newFailureStore(cfg)
+
+	if *clearHash != "" {
+		hash := *clearHash
+		if hash == "all" {
+			hash = ""
+		}
+		total := 0
+		for _, d := range dsts {
+			n, err := store.Clear(d.Name, hash)
+			if err != nil {
+				slog.Error("clear failed", logging.KeyDest, d.Name, logging.Err(err))
+				return 1
+			}
+			if n > 0 {
+				fmt.Printf("%s: cleared %d; retried on the next sync\n", d.Name, n)
+			}
+			total += n
+		}
+		if total == 0 {
+			fmt.Println("nothing to clear")
+		}
+		return 0
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEST\tHASH\tSTATE\tATTEMPTS\tLAST FAILED\tRETRY AT\tERROR\tNAME")
+	for _, d := range dsts {
+		recs, err := store.List(d.Name)
+		if err != nil {
+			slog.Error("list failures failed", logging.KeyDest, d.Name, logging.Err(err))
+			return 1
+		}
+		for _, r := range recs {
+			state := "quarantined"
+			if !r.Quarantined {
+				if !*all {
+					continue
+				}
+				state = "backing off"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", d.Name, r.Hash, state, r.Attempts,
+				formatTime(r.LastFailedAt), formatTime(r.RetryAt), r.LastError, r.Name)
+		}
+	}
+	tw.Flush()
+	return 0
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"rdmirrorsync/internal/config"
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/metrics"
+	"rdmirrorsync/internal/notify"
+	"rdmirrorsync/internal/rdapi"
+	"rdmirrorsync/internal/schedule"
+	"rdmirrorsync/internal/status"
+	"rdmirrorsync/internal/supervise"
+	"rdmirrorsync/internal/syncer"
+)
+
+// restartPolicy spaces out restarts of a destination worker that panics.
+var restartPolicy = supervise.Policy{MinBackoff: time.Second, MaxBackoff: 5 * time.Minute}
+
+// cmdRun starts the sync daemon: one goroutine per destination running on
+// its schedule until SIGINT/SIGTERM.
+func cmdRun(args []string) int {
+	fs, configPath := newFlagSet("run")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	unlock, err := lockDestinations(cfg, cfg.Destinations)
+	if err != nil {
+		slog.Error("another instance is syncing", logging.Err(err))
+		return 1
+	}
+	defer unlock()
+
+	names := make([]string, len(cfg.Destinations))
+	for i, d := range cfg.Destinations {
+		names[i] = d.Name
+	}
+	ms := status.NewMultiState(names, cfg.Interval)
+	m := metrics.NewSync(ms.Registry(), version)
+	tracer := newTracer(cfg)
+	defer shutdownTracer(tracer)
+	api := newAPI(cfg, m, tracer)
+	ms.SetHistorySize(cfg.HistorySize)
+	ms.SetHealthPolicy(status.HealthPolicy{
+		FailAfter:          cfg.HealthFailAfter,
+		DegradedErrorRatio: cfg.HealthDegradedErrorRatio,
+		FailingErrorRatio:  cfg.HealthFailingErrorRatio,
+		RunTimeout:         cfg.RunTimeout,
+	})
+	auditLog, err := openAuditLog(cfg)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	if auditLog != nil {
+		defer auditLog.Close()
+		ms.SetAuditLog(auditLog.Path())
+	}
+	deps := runnerDeps{approvals: newApprovalStore(cfg), failures: newFailureStore(cfg), lists: newListStore(cfg), tracer: tracer, audit: auditLog}
+	ms.SetApprovals(deps.approvals)
+	ms.SetFailures(deps.failures)
+	ms.SetLists(deps.lists)
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	defer closeNotifier(notifier)
+	if cfg.AdminToken != "" {
+		ms.EnableAdmin(cfg.AdminToken)
+	}
+	ms.SetAuth(status.Auth{
+		BearerToken:   cfg.HealthToken,
+		BasicUser:     cfg.HealthBasicUser,
+		BasicPassword: cfg.HealthBasicPassword,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Restore default handling so a second signal exits at once.
+		stop()
+		slog.Info("shutting down; finishing in-flight writes", "drain_timeout", cfg.DrainTimeout)
+	}()
+
+	if cfg.HealthAddr != "" {
+		go serveHealth(ctx, cfg, ms.Handler())
+	}
+
+	var wg sync.WaitGroup
+	for i, dst := range cfg.Destinations {
+		wg.Add(1)
+		go func(i int, dst config.Destination) {
+			defer wg.Done()
+
+			l := destLogger(dst.Name)
+			st := ms.For(dst.Name)
+			defer st.MarkStopped()
+			ctl := ms.Control(dst.Name)
+			ctl.SetDryRun(dst.DryRun)
+			watcher := notifier.Watch(dst.Name, notify.WatchOptions{
+				FailAfter: cfg.NotifyAfterFailures,
+				Summary:   cfg.NotifySummary,
+			})
+
+			// A panic restarts the worker with a fresh runner rather than
+			// taking down every destination.
+			supervise.Run(ctx, restartPolicy, func(ctx context.Context, restarts int) {
+				runner := newRunner(api, cfg, dst, deps)
+
+				// failures counts consecutive failed runs for backoff; runs
+				// cancelled via the admin API or shutdown don't count.
+				failures := 0
+				runOnce := func(reason string) {
+					if ctl.Paused() {
+						l.Info("paused; skipping run", "reason", reason)
+						m.RecordSkipped(dst.Name, metrics.SkipPaused, 1)
+						return
+					}
+					// Quiet hours only ever add dry-run; decided once per run.
+					quiet := dst.QuietHours.Contains(time.Now())
+					if quiet && !ctl.DryRun() {
+						l.Info("quiet hours; running read-only", "reason", reason)
+					}
+					runner.SetDryRun(ctl.DryRun() || quiet)
+
+					st.MarkStart()
+					cancelCtx, endRun := ctl.BeginRun(ctx)
+					defer endRun()
+					runCtx, cancel := runContext(cancelCtx, cfg)
+					defer cancel()
+
+					started := time.Now()
+					var stats syncer.Stats
+					err := ensureTokens(runCtx, api, st, cfg.SrcToken, dst.Token)
+					if err == nil {
+						stats, err = runner.RunOnce(runCtx)
+					}
+					m.RecordRun(dst.Name, stats, err, time.Since(started))
+					cancelled := err != nil && cancelCtx.Err() != nil
+					if cancelled && ctx.Err() == nil {
+						l.Warn("run cancelled via admin API")
+					}
+					// An interrupted run still computed a full plan; keep it.
+					if err == nil || errors.Is(err, syncer.ErrInterrupted) {
+						plan := runner.LastPlan()
+						if prev, _, ok := st.Plans(); ok {
+							if d := syncer.DiffPlans(prev, plan); !d.Empty() {
+								l.Info("plan changed since last run", "new", len(d.New), "gone", len(d.Gone))
+							}
+						}
+						st.MarkPlan(plan)
+						savePlan(cfg, plan)
+					}
+					switch {
+					case err == nil:
+						failures = 0
+					case !cancelled:
+						failures++
+					}
+					st.MarkResult(stats, err, cancelled)
+					logRunResult(l, stats, err)
+					if !cancelled {
+						health, reason := ms.Health(dst.Name)
+						watcher.RunFinished(stats, err, health, reason)
+					}
+				}
+
+				st.SetSchedule(dst.Schedule, dst.QuietHours, time.Now())
+				reason := "startup"
+				if restarts > 0 {
+					reason = "restart"
+				}
+				l.Info("starting", "mode", dst.Mode, "dry_run", dst.DryRun, "schedule", dst.Schedule.String(), "reason", reason)
+
+				// Stagger first runs so destinations don't all list the source
+				// at once; their schedules stay offset from there on.
+				if offset := time.Duration(i) * cfg.StartStagger; offset > 0 && restarts == 0 {
+					st.SetNextRun(time.Now().Add(offset))
+					l.Debug("staggering first run", "delay", offset)
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(offset):
+					}
+				}
+				runOnce(reason)
+
+				// nextSlot picks the scheduled run after slot prev and how long to
+				// wait for it. Slots that passed during the last run are skipped,
+				// failures back the schedule off, and jitter spreads destinations
+				// sharing a schedule.
+				nextSlot := func(prev time.Time) (time.Time, time.Duration) {
+					now := time.Now()
+					next, missed := schedule.NextAfter(dst.Schedule, prev, now)
+					if missed > 0 {
+						l.Info("skipped scheduled runs that passed while the previous run was going", "count", missed)
+						m.RecordSkipped(dst.Name, metrics.SkipOverlap, missed)
+					}
+					next, backedOff := schedule.Backoff(dst.Schedule, next, failures, cfg.BackoffMax, now)
+					if backedOff > 0 {
+						l.Warn("backing off after failed runs", "failures", failures, "skipped", backedOff, "next_run_at", next)
+						m.RecordSkipped(dst.Name, metrics.SkipBackoff, backedOff)
+					}
+					st.SetNextRun(next)
+					return next, time.Until(next) + schedule.Jitter(cfg.Jitter)
+				}
+				next, wait := nextSlot(time.Now())
+				timer := time.NewTimer(wait)
+				defer timer.Stop()
+
+				for {
+					select {
+					case <-ctx.Done():
+						l.Info("shutdown signal received; exiting")
+						return
+					case <-timer.C:
+						runOnce("scheduled")
+						next, wait = nextSlot(next)
+						timer.Reset(wait)
+					case <-ctl.Triggered():
+						runOnce("triggered")
+					}
+				}
+			}, func(p supervise.Panic) {
+				st.MarkPanic(p.Value, p.Stack, !p.Final)
+				if p.Final {
+					l.Error("worker panicked while stopping", "panic", p.Value, "stack", string(p.Stack))
+					return
+				}
+				l.Error("worker panicked; restarting", "panic", p.Value, "restarts", p.Restarts,
+					"restart_in", p.Wait, "stack", string(p.Stack))
+				m.RecordRestart(dst.Name)
+			})
+		}(i, dst)
+	}
+
+	wg.Wait()
+	return 0
+}
+
+// ensureTokens checks both tokens with GET /user until they pass once, so
+// /readyz can tell bad credentials apart from a run that failed for another
+// reason.
+func ensureTokens(ctx context.Context, api *rdapi.Client, st *status.State, srcToken, dstToken string) error {
+	if st.TokensValid() {
+		return nil
+	}
+	err := checkTokens(ctx, api, srcToken, dstToken)
+	st.MarkTokens(err)
+	return err
+}
+
+func checkTokens(ctx context.Context, api *rdapi.Client, srcToken, dstToken string) error {
+	if _, err := api.User(ctx, srcToken); err != nil {
+		return fmt.Errorf("check source token: %w", err)
+	}
+	if _, err := api.User(ctx, dstToken); err != nil {
+		return fmt.Errorf("check destination token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"rdmirrorsync/internal/config"
+	"rdmirrorsync/internal/logging"
+)
+
+const unixAddrPrefix = "unix:"
+
+// serveHealth serves h on cfg.HealthAddr until ctx is done. A "unix:/path"
+// address listens on a unix socket; health_tls_cert/key switch to HTTPS.
+func serveHealth(ctx context.Context, cfg config.Config, h http.Handler) {
+	ln, err := listenHealth(cfg.HealthAddr)
+	if err != nil {
+		slog.Error("health server failed to listen", "addr", cfg.HealthAddr, logging.Err(err))
+		return
+	}
+
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if cfg.HealthTLSCert != "" {
+		slog.Info("health server listening", "addr", cfg.HealthAddr, "tls", true)
+		err = srv.ServeTLS(ln, cfg.HealthTLSCert, cfg.HealthTLSKey)
+	} else {
+		slog.Info("health server listening", "addr", cfg.HealthAddr, "tls", false)
+		err = srv.Serve(ln)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("health server stopped", logging.Err(err))
+	}
+}
+
+func listenHealth(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixAddrPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// Clear a socket left behind by a previous process, but never a regular file.
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"rdmirrorsync/internal/config"
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/syncer"
+)
+
+// healthSnapshot mirrors the per-destination JSON served by /healthz.
+type healthSnapshot struct {
+	Healthy       bool         `json:"healthy"`
+	Health        string       `json:"health"`
+	Reason        string       `json:"reason"`
+	Running       bool         `json:"running"`
+	LastRunAt     time.Time    `json:"last_run_at"`
+	LastSuccessAt time.Time    `json:"last_success_at"`
+	NextRunAt     time.Time    `json:"next_run_at"`
+	LastError     string       `json:"last_error"`
+	LastOK        bool         `json:"last_ok"`
+	LastStats     syncer.Stats `json:"last_stats"`
+}
+
+// cmdStatus queries a running daemon's /healthz and prints a summary. It
+// exits non-zero when the daemon reports failing or cannot be reached;
+// degraded destinations still exit zero.
+func cmdStatus(args []string) int {
+	fs, configPath := newFlagSet("status")
+	baseURL := fs.String("url", "", "daemon base URL, e.g. http://localhost:8099 (default derived from health_addr)")
+	token := fs.String("token", "", "bearer token for the health server (default health_token from config)")
+	insecure := fs.Bool("insecure", false, "skip TLS certificate verification")
+	dest := fs.String("dest", "", "only show this destination")
+	raw := fs.Bool("json", false, "print the raw /healthz JSON")
+	timeout := fs.Duration("timeout", 5*time.Second, "request timeout")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	var cfg config.Config
+	if *baseURL == "" {
+		var err error
+		cfg, err = loadConfig(*configPath)
+		if err != nil {
+			slog.Error(err.Error())
+			return 1
+		}
+		if cfg.HealthAddr == "" {
+			slog.Error("health_addr is not set in the config; pass -url")
+			return 2
+		}
+	}
+	if *token != "" {
+		cfg.HealthToken = *token
+	}
+
+	client, base := healthClient(cfg, *baseURL, *timeout, *insecure)
+	u := base + "/healthz"
+	if *dest != "" {
+		u += "?dest=" + url.QueryEscape(*dest)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		slog.Error("build request failed", logging.Err(err))
+		return 2
+	}
+	setHealthAuth(req, cfg)
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Error("query failed", "url", u, logging.Err(err))
+		return 1
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		slog.Error("read response failed", "url", u, logging.Err(err))
+		return 1
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		slog.Error("unauthorized; set health_token in the config or pass -token", "url", u)
+		return 1
+	}
+	if resp.StatusCode == http.StatusNotFound && *dest != "" {
+		slog.Error("unknown destination", logging.KeyDest, *dest)
+		return 2
+	}
+
+	if *raw {
+		os.Stdout.Write(body)
+	}
+
+	snaps := make(map[string]healthSnapshot)
+	healthy := false
+	if *dest != "" {
+		var snap healthSnapshot
+		if err := json.Unmarshal(body, &snap); err != nil {
+			slog.Error("decode response failed", "url", u, logging.Err(err))
+			return 1
+		}
+		snaps[*dest] = snap
+		healthy = snap.Healthy
+	} else {
+		var all struct {
+			Healthy      bool                      `json:"healthy"`
+			Destinations map[string]healthSnapshot `json:"destinations"`
+		}
+		if err := json.Unmarshal(body, &all); err != nil {
+			slog.Error("decode response failed", "url", u, logging.Err(err))
+			return 1
+		}
+		snaps = all.Destinations
+		healthy = all.Healthy
+	}
+
+	if !*raw {
+		printStatusTable(os.Stdout, snaps)
+	}
+	if !healthy {
+		return 1
+	}
+	return 0
+}
+
+func printStatusTable(w io.Writer, snaps map[string]healthSnapshot) {
+	names := make([]string, 0, len(snaps))
+	for n := range snaps {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEST\tHEALTH\tRUNNING\tLAST RUN\tNEXT RUN\tLAST SUCCESS\tADDED\tDELETED\tERRORS\tREASON\tLAST ERROR")
+	for _, n := range names {
+		s := snaps[n]
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			n, s.Health, s.Running, formatTime(s.LastRunAt), formatTime(s.NextRunAt), formatTime(s.LastSuccessAt),
+			s.LastStats.Added, s.LastStats.Deleted, s.LastStats.AddErrors+s.LastStats.DeleteErrors,
+			dashIfEmpty(s.Reason), s.LastError)
+	}
+	tw.Flush()
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// healthClient returns an HTTP client and base URL for reaching the daemon's
+// health server. baseURL wins when set; otherwise they are derived from
+// cfg.HealthAddr, dialling the socket directly for "unix:" addresses.
+func healthClient(cfg config.Config, baseURL string, timeout time.Duration, insecure bool) (*http.Client, string) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Timeout: timeout, Transport: tr}
+
+	if baseURL != "" {
+		return client, strings.TrimRight(baseURL, "/")
+	}
+	if path, ok := strings.CutPrefix(cfg.HealthAddr, unixAddrPrefix); ok {
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		return client, "http://unix"
+	}
+	return client, healthBaseURL(cfg.HealthAddr, cfg.HealthTLSCert != "")
+}
+
+// setHealthAuth adds the health server credentials from cfg to req, if any.
+func setHealthAuth(req *http.Request, cfg config.Config) {
+	switch {
+	case cfg.HealthToken != "":
+		req.Header.Set("Authorization", "Bearer "+cfg.HealthToken)
+	case cfg.HealthBasicUser != "":
+		req.SetBasicAuth(cfg.HealthBasicUser, cfg.HealthBasicPassword)
+	}
+}
+
+// healthBaseURL turns a listen address like ":8099" or "0.0.0.0:8099" into a
+// URL reachable from the local machine.
+func healthBaseURL(addr string, useTLS bool) string {
+	scheme := "http://"
+	if useTLS {
+		scheme = "https://"
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return scheme + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return scheme + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+)
+
+// cmdValidate loads and validates the config, printing the resolved
+// destinations. Tokens are never printed.
+func cmdValidate(args []string) int {
+	fs, configPath := newFlagSet("validate")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+
+	fmt.Printf("config OK: interval=%s run_timeout=%s health_addr=%q\n", cfg.Interval, cfg.RunTimeout, cfg.HealthAddr)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEST\tMODE\tDRY RUN\tPROTECT REGEX")
+	for _, d := range cfg.Destinations {
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\n", d.Name, d.Mode, d.DryRun, d.ProtectDstRegex)
+	}
+	tw.Flush()
+	return 0
+}
@@ -0,0 +1,299 @@
+// Package approval persists mirror-delete plans that need human sign-off
+// before their deletes run.
+//
+// Each destination has at most one current record, stored as
+// "<dir>/<dest>.json". The record ID is derived from the destination name and
+// the exact set of torrents to delete, so when the diff changes the next run
+// computes a different ID and the old record is replaced (invalidated).
+package approval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/syncer"
+)
+
+// Status is the lifecycle state of a delete plan.
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusApplied  Status = "applied"
+)
+
+// ErrNotFound is returned by Approve when no current plan has the given ID,
+// either because it never existed or because it went stale.
+var ErrNotFound = errors.New("unknown or stale plan id")
+
+// ErrApplied is returned by Approve when the plan's deletes already ran.
+var ErrApplied = errors.New("plan was already applied")
+
+// Record is a persisted delete plan awaiting or holding approval.
+type Record struct {
+	ID         string            `json:"id"`
+	Dest       string            `json:"dest"`
+	Status     Status            `json:"status"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ApprovedAt time.Time         `json:"approved_at,omitempty"`
+	AppliedAt  time.Time         `json:"applied_at,omitempty"`
+	Deletes    []syncer.PlanItem `json:"deletes"`
+}
+
+// Store reads and writes delete plan records in a directory. It is safe for
+// concurrent use within one process; writes are atomic renames so a CLI
+// approving a plan cannot leave a half-written file for the daemon.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewStore returns a Store rooted at dir. The directory is created on first write.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// PlanID returns the content-derived ID for a destination's delete set.
+func PlanID(dest string, deletes []syncer.PlanItem) string {
+	lines := make([]string, len(deletes))
+	for i, it := range deletes {
+		lines[i] = it.Hash + "|" + it.DestID
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	h.Write([]byte(dest))
+	for _, l := range lines {
+		h.Write([]byte{'\n'})
+		h.Write([]byte(l))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// Get returns the current record for dest, if any.
+func (s *Store) Get(dest string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(dest)
+}
+
+// List returns the current record of every destination, ordered by dest.
+func (s *Store) List() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Record{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := []Record{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		rec, err := readFile(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Dest < out[j].Dest })
+	return out, nil
+}
+
+// Approve marks the pending plan with the given ID as approved. Its deletes
+// execute on the destination's next run, provided the diff is unchanged.
+func (s *Store) Approve(id string) (Record, error) {
+	recs, err := s.List()
+	if err != nil {
+		return Record{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, listed := range recs {
+		if listed.ID != id {
+			continue
+		}
+		// Re-read under the lock: a run may have replaced the record since List.
+		rec, ok, err := s.read(listed.Dest)
+		if err != nil {
+			return Record{}, err
+		}
+		if !ok || rec.ID != id {
+			return Record{}, ErrNotFound
+		}
+		switch rec.Status {
+		case StatusApproved:
+			return rec, nil
+		case StatusApplied:
+			return rec, fmt.Errorf("plan %s: %w", id, ErrApplied)
+		}
+		rec.Status = StatusApproved
+		rec.ApprovedAt = time.Now()
+		return rec, s.write(rec)
+	}
+	return Record{}, ErrNotFound
+}
+
+func (s *Store) path(dest string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, dest)
+	return filepath.Join(s.dir, safe+".json")
+}
+
+func (s *Store) read(dest string) (Record, bool, error) {
+	rec, err := readFile(s.path(dest))
+	if errors.Is(err, os.ErrNotExist) {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, err
+	}
+	return rec, true, nil
+}
+
+func readFile(path string) (Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Record{}, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Record{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rec, nil
+}
+
+func (s *Store) write(rec Record) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".approval-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(rec.Dest))
+}
+
+func (s *Store) remove(dest string) error {
+	err := os.Remove(s.path(dest))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Gate is a syncer.DeleteGate for one destination. Delete sets larger than
+// the threshold need an approved record; smaller ones run straight away.
+type Gate struct {
+	store     *Store
+	dest      string
+	threshold int
+}
+
+// NewGate returns a gate for dest that requires approval when a run would
+// delete more than threshold torrents. A threshold of 0 gates every delete.
+func NewGate(store *Store, dest string, threshold int) *Gate {
+	return &Gate{store: store, dest: dest, threshold: threshold}
+}
+
+func (g *Gate) log() *slog.Logger {
+	return slog.With(logging.KeyDest, g.dest, logging.KeyOp, "delete")
+}
+
+// AllowDeletes implements syncer.DeleteGate.
+func (g *Gate) AllowDeletes(plan syncer.Plan) (bool, error) {
+	g.store.mu.Lock()
+	defer g.store.mu.Unlock()
+
+	cur, ok, err := g.store.read(g.dest)
+	if err != nil {
+		return false, err
+	}
+
+	if len(plan.Deletes) <= g.threshold {
+		if ok && cur.Status != StatusApplied {
+			g.log().Info("delete plan invalidated: diff changed", "plan_id", cur.ID)
+			return true, g.store.remove(g.dest)
+		}
+		return true, nil
+	}
+
+	id := PlanID(g.dest, plan.Deletes)
+	if ok && cur.ID == id {
+		switch cur.Status {
+		case StatusApproved:
+			return true, nil
+		case StatusPending:
+			return false, nil
+		}
+		// Applied but the same deletes are planned again (e.g. every delete
+		// failed); ask for approval afresh.
+	}
+	if ok && cur.ID != id && cur.Status != StatusApplied {
+		g.log().Info("delete plan invalidated: diff changed", "plan_id", cur.ID)
+	}
+
+	rec := Record{
+		ID:        id,
+		Dest:      g.dest,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+		Deletes:   plan.Deletes,
+	}
+	if err := g.store.write(rec); err != nil {
+		return false, err
+	}
+	g.log().Warn("delete plan needs approval", "plan_id", id, "deletes", len(plan.Deletes),
+		"approve_with", "rd-mirror-sync approve "+id+" or POST /approvals/approve?id="+id)
+	return false, nil
+}
+
+// DeletesApplied implements syncer.DeleteGate.
+func (g *Gate) DeletesApplied(plan syncer.Plan) error {
+	g.store.mu.Lock()
+	defer g.store.mu.Unlock()
+
+	cur, ok, err := g.store.read(g.dest)
+	if err != nil || !ok {
+		return err
+	}
+	if cur.ID != PlanID(g.dest, plan.Deletes) {
+		return nil
+	}
+	cur.Status = StatusApplied
+	cur.AppliedAt = time.Now()
+	return g.store.write(cur)
+}
@@ -0,0 +1,87 @@
+package approval
+
+import (
+	"errors"
+	"testing"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+func deletePlan(hashes ...string) syncer.Plan {
+	p := syncer.Plan{Dest: "x"}
+	for _, h := range hashes {
+		p.Deletes = append(p.Deletes, syncer.PlanItem{Hash: h, DestID: "id-" + h})
+	}
+	return p
+}
+
+func TestGateRequiresApproval(t *testing.T) {
+	store := NewStore(t.TempDir())
+	gate := NewGate(store, "x", 1)
+	plan := deletePlan("a", "b")
+
+	ok, err := gate.AllowDeletes(plan)
+	if err != nil || ok {
+		t.Fatalf("expected deletes held on first run, got ok=%v err=%v", ok, err)
+	}
+	rec, found, err := store.Get("x")
+	if err != nil || !found || rec.Status != StatusPending {
+		t.Fatalf("expected pending record, got %+v found=%v err=%v", rec, found, err)
+	}
+
+	if ok, _ := gate.AllowDeletes(plan); ok {
+		t.Fatal("expected deletes still held before approval")
+	}
+	if _, err := store.Approve(rec.ID); err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+	if ok, err := gate.AllowDeletes(plan); err != nil || !ok {
+		t.Fatalf("expected deletes allowed after approval, got ok=%v err=%v", ok, err)
+	}
+	if err := gate.DeletesApplied(plan); err != nil {
+		t.Fatalf("DeletesApplied failed: %v", err)
+	}
+	if _, err := store.Approve(rec.ID); !errors.Is(err, ErrApplied) {
+		t.Fatalf("expected ErrApplied re-approving an applied plan, got %v", err)
+	}
+}
+
+func TestGateInvalidatesStalePlan(t *testing.T) {
+	store := NewStore(t.TempDir())
+	gate := NewGate(store, "x", 0)
+
+	if ok, _ := gate.AllowDeletes(deletePlan("a")); ok {
+		t.Fatal("expected deletes held")
+	}
+	stale, _, _ := store.Get("x")
+
+	// The diff changes before anyone approves: the old ID must stop working.
+	if ok, _ := gate.AllowDeletes(deletePlan("a", "b")); ok {
+		t.Fatal("expected new plan held")
+	}
+	if _, err := store.Approve(stale.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for stale plan, got %v", err)
+	}
+
+	// Approving the current plan and then changing the diff again also invalidates it.
+	cur, _, _ := store.Get("x")
+	if _, err := store.Approve(cur.ID); err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+	if ok, _ := gate.AllowDeletes(deletePlan("b")); ok {
+		t.Fatal("expected changed plan held despite earlier approval")
+	}
+}
+
+func TestGateBelowThresholdRunsImmediately(t *testing.T) {
+	store := NewStore(t.TempDir())
+	gate := NewGate(store, "x", 2)
+
+	if ok, err := gate.AllowDeletes(deletePlan("a", "b")); err != nil || !ok {
+		t.Fatalf("expected deletes at threshold allowed, got ok=%v err=%v", ok, err)
+	}
+	recs, err := store.List()
+	if err != nil || len(recs) != 0 {
+		t.Fatalf("expected no records, got %+v err=%v", recs, err)
+	}
+}
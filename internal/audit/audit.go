@@ -0,0 +1,121 @@
+// Package audit keeps an append-only JSON-lines log of every add and delete
+// made to a destination, one syncer.AuditEvent per line.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+// Log appends events to a file. It is safe for concurrent use by the
+// runners of several destinations.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// Open opens (creating if needed) the audit log at path for appending.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return &Log{path: path, f: f}, nil
+}
+
+// Path returns the file the log writes to.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Record implements syncer.Auditor. Each event is written with a single
+// write call so lines from concurrent writers never interleave.
+func (l *Log) Record(e syncer.AuditEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.f.Write(b)
+	return err
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Filter selects events in Read. Zero fields match everything.
+type Filter struct {
+	Dest   string
+	Hash   string // case-insensitive
+	Action string
+	Since  time.Time
+	// Limit keeps only the newest Limit matches.
+	Limit int
+}
+
+func (f Filter) match(e syncer.AuditEvent) bool {
+	return (f.Dest == "" || e.Dest == f.Dest) &&
+		(f.Hash == "" || strings.EqualFold(e.Hash, f.Hash)) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since))
+}
+
+// Read returns the events in the log at path matching f, oldest first. A
+// missing file yields no events. Malformed lines, such as a partial line
+// left by a crash, are skipped.
+func Read(path string, f Filter) ([]syncer.AuditEvent, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return read(file, f)
+}
+
+func read(r io.Reader, f Filter) ([]syncer.AuditEvent, error) {
+	var out []syncer.AuditEvent
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e syncer.AuditEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		if !f.match(e) {
+			continue
+		}
+		out = append(out, e)
+		if f.Limit > 0 && len(out) > 2*f.Limit {
+			out = append(out[:0], out[len(out)-f.Limit:]...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[len(out)-f.Limit:]
+	}
+	return out, nil
+}
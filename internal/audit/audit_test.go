@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []syncer.AuditEvent{
+		{Time: base, Dest: "loc1", Action: syncer.ActionAdd, Hash: "aaa", TorrentID: "1", Reason: syncer.ReasonMissingOnDest},
+		{Time: base.Add(time.Hour), Dest: "loc2", Action: syncer.ActionDelete, Hash: "bbb", TorrentID: "2", Reason: syncer.ReasonNotInSource},
+		{Time: base.Add(2 * time.Hour), Dest: "loc2", Action: syncer.ActionDelete, Hash: "ccc", TorrentID: "3", Reason: syncer.ReasonNotInSource, Error: "status=500"},
+	}
+	for _, e := range events {
+		if err := l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A torn final line from a crash is skipped.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"time":"2024-05`)
+	f.Close()
+
+	got, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[2].Error != "status=500" || !got[0].Time.Equal(base) {
+		t.Fatalf("Read all: %+v", got)
+	}
+
+	got, _ = Read(path, Filter{Dest: "loc2", Hash: "BBB"})
+	if len(got) != 1 || got[0].TorrentID != "2" {
+		t.Fatalf("dest+hash filter: %+v", got)
+	}
+	got, _ = Read(path, Filter{Action: syncer.ActionDelete, Limit: 1})
+	if len(got) != 1 || got[0].Hash != "ccc" {
+		t.Fatalf("limit keeps newest: %+v", got)
+	}
+	got, _ = Read(path, Filter{Since: base.Add(30 * time.Minute)})
+	if len(got) != 2 {
+		t.Fatalf("since filter: %+v", got)
+	}
+
+	if got, err := Read(filepath.Join(t.TempDir(), "missing.jsonl"), Filter{}); err != nil || len(got) != 0 {
+		t.Fatalf("missing file: %v %v", got, err)
+	}
+}
+
+func TestConcurrentRecordsDoNotInterleave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for d := 0; d < 4; d++ {
+		wg.Add(1)
+		go func(d int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_ = l.Record(syncer.AuditEvent{Dest: fmt.Sprintf("d%d", d), Action: syncer.ActionAdd, Hash: fmt.Sprint(i)})
+			}
+		}(d)
+	}
+	wg.Wait()
+	l.Close()
+
+	got, err := Read(path, Filter{})
+	if err != nil || len(got) != 200 {
+		t.Fatalf("got %d events, err=%v", len(got), err)
+	}
+}
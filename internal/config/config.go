@@ -4,11 +4,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/notify"
+	"rdmirrorsync/internal/schedule"
 	"rdmirrorsync/internal/syncer"
+	"rdmirrorsync/internal/tracing"
 )
 
 const (
@@ -23,6 +31,21 @@ const (
 	defaultRetryBase   = 500 * time.Millisecond
 	defaultRetryJitter = 350 * time.Millisecond
 	defaultPageLimit   = 250
+	defaultPlanFormat  = "json"
+	defaultStateDir    = "state"
+	defaultHistorySize = 50
+	defaultNotifyAfter = 3
+	defaultHealthFail  = 3
+	defaultStagger     = 5 * time.Second
+	defaultJitter      = 5 * time.Second
+	defaultBackoffMax  = 30 * time.Minute
+	defaultDrain       = 30 * time.Second
+	defaultReconcile   = time.Hour
+	defaultFailBackoff = 15 * time.Minute
+	defaultFailMax     = 24 * time.Hour
+	defaultQuarantine  = 5
+
+	defaultNotifyMinInterval = 15 * time.Minute
 )
 
 // rawDestination is the JSON shape for a single destination entry.
@@ -31,8 +54,15 @@ type rawDestination struct {
 	Token           string `json:"token"`
 	Mode            string `json:"mode"`
 	DryRun          *bool  `json:"dry_run"`
+	Dedupe          *bool  `json:"dedupe"`
 	Enabled         *bool  `json:"enabled"`
 	ProtectDstRegex string `json:"protect_dst_regex"`
+
+	DeleteApprovalOver *int `json:"delete_approval_over"`
+
+	Interval   string   `json:"interval"`
+	Schedule   string   `json:"schedule"`
+	QuietHours []string `json:"quiet_hours"`
 }
 
 // rawConfig is the JSON shape of the config file.
@@ -40,17 +70,70 @@ type rawConfig struct {
 	SrcToken       string           `json:"src_token"`
 	BaseURL        string           `json:"base_url"`
 	HealthAddr     string           `json:"health_addr"`
+	AdminToken     string           `json:"admin_token"`
 	Mode           string           `json:"mode"`
 	DryRun         bool             `json:"dry_run"`
+	Dedupe         bool             `json:"dedupe"`
 	Interval       string           `json:"interval"`
+	Schedule       string           `json:"schedule"`
+	QuietHours     []string         `json:"quiet_hours"`
+	StartStagger   string           `json:"start_stagger"`
+	Jitter         string           `json:"jitter"`
+	BackoffMax     string           `json:"backoff_max"`
 	RunTimeout     string           `json:"run_timeout"`
+	DrainTimeout   string           `json:"drain_timeout"`
+	FullReconcile  string           `json:"full_reconcile_interval"`
 	HTTPTimeout    string           `json:"http_timeout"`
 	WriteDelay     string           `json:"write_delay"`
 	MaxRetries     int              `json:"max_retries"`
 	RetryBase      string           `json:"retry_base"`
 	RetryMaxJitter string           `json:"retry_max_jitter"`
 	PageLimit      int              `json:"page_limit"`
+	PlanDir        string           `json:"plan_dir"`
+	PlanFormat     string           `json:"plan_format"`
+	StateDir       string           `json:"state_dir"`
 	Destinations   []rawDestination `json:"destinations"`
+
+	DeleteApprovalOver *int `json:"delete_approval_over"`
+
+	FailureBackoff    string `json:"failure_backoff"`
+	FailureBackoffMax string `json:"failure_backoff_max"`
+	QuarantineAfter   *int   `json:"quarantine_after"`
+
+	HealthToken         string `json:"health_token"`
+	HealthBasicUser     string `json:"health_basic_user"`
+	HealthBasicPassword string `json:"health_basic_password"`
+	HealthTLSCert       string `json:"health_tls_cert"`
+	HealthTLSKey        string `json:"health_tls_key"`
+
+	HealthFailAfter          int      `json:"health_fail_after"`
+	HealthDegradedErrorRatio *float64 `json:"health_degraded_error_ratio"`
+	HealthFailingErrorRatio  *float64 `json:"health_failing_error_ratio"`
+
+	OTLPEndpoint string            `json:"otlp_endpoint"`
+	OTLPHeaders  map[string]string `json:"otlp_headers"`
+
+	LogLevel  string `json:"log_level"`
+	LogFormat string `json:"log_format"`
+
+	HistorySize int    `json:"history_size"`
+	AuditLog    string `json:"audit_log"`
+
+	Notify              []rawNotifier `json:"notify"`
+	NotifyAfterFailures int           `json:"notify_after_failures"`
+	NotifyMinInterval   string        `json:"notify_min_interval"`
+	NotifySummary       string        `json:"notify_summary"`
+}
+
+// rawNotifier is the JSON shape for a notification sink.
+type rawNotifier struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Token   string   `json:"token"`
+	ChatID  string   `json:"chat_id"`
+	Targets string   `json:"targets"`
+	Events  []string `json:"events"`
 }
 
 // Destination is a fully resolved destination with all per-destination
@@ -61,31 +144,103 @@ type Destination struct {
 	Mode            syncer.Mode
 	DryRun          bool
 	ProtectDstRegex string
+
+	// Dedupe deletes extra copies of hashes the destination holds more than
+	// once.
+	Dedupe bool
+
+	// DeleteApproval requires a human to approve mirror-delete plans with
+	// more than DeleteApprovalOver deletes before they run.
+	DeleteApproval     bool
+	DeleteApprovalOver int
+
+	// Schedule decides when scheduled runs happen; QuietHours are daily
+	// windows during which every run is read-only.
+	Schedule   schedule.Schedule
+	QuietHours schedule.Windows
 }
 
 // Config is the resolved, validated configuration.
 type Config struct {
 	SrcToken       string
 	BaseURL        string
-	HealthAddr     string
+	HealthAddr     string // host:port, or "unix:/path" for a unix socket
+	AdminToken     string // enables the /admin endpoints; empty disables them
 	Interval       time.Duration
+	StartStagger   time.Duration // delay between destinations' first runs
+	Jitter         time.Duration // max random delay added to each scheduled run
+	BackoffMax     time.Duration // cap on failure backoff; 0 disables it
 	RunTimeout     time.Duration
+	DrainTimeout   time.Duration // how long an in-flight write may finish after shutdown
+	FullReconcile  time.Duration // max age of the cached destination listing; 0 lists every run
 	HTTPTimeout    time.Duration
 	WriteDelay     time.Duration
 	MaxRetries     int
 	RetryBase      time.Duration
 	RetryMaxJitter time.Duration
 	PageLimit      int
+	PlanDir        string // empty disables writing plan files
+	PlanFormat     string // "json" or "csv"
+	StateDir       string
 	Destinations   []Destination
+
+	// A hash whose add fails is not tried again for FailureBackoff, doubling
+	// per failure up to FailureBackoffMax, and is quarantined after
+	// QuarantineAfter failures (0 never quarantines).
+	FailureBackoff    time.Duration
+	FailureBackoffMax time.Duration
+	QuarantineAfter   int
+
+	// Health server auth and TLS. With a token or basic user set, only the
+	// /healthz summary is public.
+	HealthToken         string
+	HealthBasicUser     string
+	HealthBasicPassword string
+	HealthTLSCert       string
+	HealthTLSKey        string
+
+	// Health thresholds: HealthFailAfter consecutive failed runs, or a run
+	// whose share of failed adds and deletes reaches HealthFailingErrorRatio,
+	// is failing; anything above HealthDegradedErrorRatio is degraded.
+	HealthFailAfter          int
+	HealthDegradedErrorRatio float64
+	HealthFailingErrorRatio  float64
+
+	// OTLPEndpoint enables tracing, exported over OTLP/HTTP (JSON) to this
+	// collector URL. OTLPHeaders are sent with every export.
+	OTLPEndpoint string
+	OTLPHeaders  map[string]string
+
+	LogLevel  slog.Level
+	LogFormat string // "text" or "json"
+
+	HistorySize int    // runs kept per destination for /history
+	AuditLog    string // JSON-lines file of adds and deletes; empty disables
+
+	Notifiers           []notify.SinkConfig
+	NotifyAfterFailures int
+	NotifyMinInterval   time.Duration // per destination and event kind
+	NotifySummary       string        // notify.SummaryOff, SummaryChanges or SummaryAlways
 }
 
 // Load reads and validates the config file. The path defaults to "config.json"
 // in the working directory and can be overridden with the CONFIG_FILE env var.
 func Load() (Config, error) {
+	return LoadFile(Path())
+}
+
+// Path returns the config file path Load would read: CONFIG_FILE if set,
+// otherwise "config.json" in the working directory.
+func Path() string {
 	path := strings.TrimSpace(os.Getenv("CONFIG_FILE"))
 	if path == "" {
-		path = defaultConfigPath
+		return defaultConfigPath
 	}
+	return path
+}
+
+// LoadFile reads and validates the config file at path.
+func LoadFile(path string) (Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return Config{}, fmt.Errorf("read config %q: %w", path, err)
@@ -121,19 +276,97 @@ func resolve(raw rawConfig) (Config, error) {
 		SrcToken:       srcToken,
 		BaseURL:        stringOr(raw.BaseURL, defaultBaseURL),
 		HealthAddr:     raw.HealthAddr,
+		AdminToken:     stringOr(raw.AdminToken, os.Getenv("ADMIN_TOKEN")),
 		Interval:       durationOr(raw.Interval, defaultInterval),
+		StartStagger:   durationOr(raw.StartStagger, defaultStagger),
+		Jitter:         durationOr(raw.Jitter, defaultJitter),
+		BackoffMax:     durationOr(raw.BackoffMax, defaultBackoffMax),
 		RunTimeout:     durationOr(raw.RunTimeout, defaultRunTimeout),
+		DrainTimeout:   durationOr(raw.DrainTimeout, defaultDrain),
+		FullReconcile:  durationOr(raw.FullReconcile, defaultReconcile),
 		HTTPTimeout:    durationOr(raw.HTTPTimeout, defaultHTTPTimeout),
 		WriteDelay:     durationOr(raw.WriteDelay, defaultWriteDelay),
 		MaxRetries:     intOr(raw.MaxRetries, defaultMaxRetries),
 		RetryBase:      durationOr(raw.RetryBase, defaultRetryBase),
 		RetryMaxJitter: durationOr(raw.RetryMaxJitter, defaultRetryJitter),
 		PageLimit:      intOr(raw.PageLimit, defaultPageLimit),
+		PlanDir:        strings.TrimSpace(raw.PlanDir),
+		PlanFormat:     stringOr(raw.PlanFormat, defaultPlanFormat),
+		StateDir:       stringOr(raw.StateDir, defaultStateDir),
+
+		FailureBackoff:    durationOr(raw.FailureBackoff, defaultFailBackoff),
+		FailureBackoffMax: durationOr(raw.FailureBackoffMax, defaultFailMax),
+		QuarantineAfter:   defaultQuarantine,
+
+		HealthToken:         stringOr(raw.HealthToken, os.Getenv("HEALTH_TOKEN")),
+		HealthBasicUser:     strings.TrimSpace(raw.HealthBasicUser),
+		HealthBasicPassword: stringOr(raw.HealthBasicPassword, os.Getenv("HEALTH_BASIC_PASSWORD")),
+		HealthTLSCert:       strings.TrimSpace(raw.HealthTLSCert),
+		HealthTLSKey:        strings.TrimSpace(raw.HealthTLSKey),
+
+		HealthFailAfter:          intOr(raw.HealthFailAfter, defaultHealthFail),
+		HealthDegradedErrorRatio: floatOr(raw.HealthDegradedErrorRatio, 0),
+		HealthFailingErrorRatio:  floatOr(raw.HealthFailingErrorRatio, 1),
+
+		OTLPEndpoint: stringOr(raw.OTLPEndpoint, os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
+		OTLPHeaders:  raw.OTLPHeaders,
+
+		LogFormat: stringOr(raw.LogFormat, stringOr(os.Getenv("LOG_FORMAT"), logging.FormatText)),
+
+		HistorySize: intOr(raw.HistorySize, defaultHistorySize),
+
+		NotifyAfterFailures: intOr(raw.NotifyAfterFailures, defaultNotifyAfter),
+		NotifyMinInterval:   durationOr(raw.NotifyMinInterval, defaultNotifyMinInterval),
+		NotifySummary:       stringOr(raw.NotifySummary, notify.SummaryOff),
+	}
+	switch audit := strings.TrimSpace(raw.AuditLog); audit {
+	case "off":
+	case "":
+		cfg.AuditLog = filepath.Join(cfg.StateDir, "audit.jsonl")
+	default:
+		cfg.AuditLog = audit
+	}
+	cfg.LogLevel, err = logging.ParseLevel(stringOr(raw.LogLevel, stringOr(os.Getenv("LOG_LEVEL"), "info")))
+	if err != nil {
+		return Config{}, fmt.Errorf("log_level: %w", err)
+	}
+	if cfg.LogFormat != logging.FormatText && cfg.LogFormat != logging.FormatJSON {
+		return Config{}, fmt.Errorf("invalid log_format %q (expected text or json)", cfg.LogFormat)
+	}
+	if len(cfg.OTLPHeaders) == 0 && os.Getenv("OTEL_EXPORTER_OTLP_HEADERS") != "" {
+		h, err := tracing.ParseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+		if err != nil {
+			return Config{}, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+		}
+		cfg.OTLPHeaders = h
 	}
 
 	if cfg.Interval < 10*time.Second {
 		return Config{}, errors.New("interval must be >= 10s")
 	}
+	if cfg.Jitter >= cfg.Interval {
+		return Config{}, errors.New("jitter must be below interval")
+	}
+	if strings.TrimSpace(raw.Interval) != "" && strings.TrimSpace(raw.Schedule) != "" {
+		return Config{}, errors.New("set interval or schedule, not both")
+	}
+	globalSched, err := resolveSchedule("", raw.Schedule, schedule.Every(cfg.Interval))
+	if err != nil {
+		return Config{}, err
+	}
+	globalQuiet, err := schedule.ParseWindows(raw.QuietHours)
+	if err != nil {
+		return Config{}, fmt.Errorf("quiet_hours: %w", err)
+	}
+	if raw.QuarantineAfter != nil {
+		if *raw.QuarantineAfter < 0 {
+			return Config{}, errors.New("quarantine_after must be >= 0")
+		}
+		cfg.QuarantineAfter = *raw.QuarantineAfter
+	}
+	if cfg.FailureBackoffMax < cfg.FailureBackoff {
+		return Config{}, errors.New("failure_backoff_max must be >= failure_backoff")
+	}
 	if cfg.HTTPTimeout <= 0 {
 		return Config{}, errors.New("http_timeout must be > 0")
 	}
@@ -143,6 +376,38 @@ func resolve(raw rawConfig) (Config, error) {
 	if cfg.PageLimit < 1 {
 		return Config{}, errors.New("page_limit must be >= 1")
 	}
+	if cfg.HealthBasicUser != "" && cfg.HealthBasicPassword == "" {
+		return Config{}, errors.New("health_basic_user requires health_basic_password (or HEALTH_BASIC_PASSWORD env var)")
+	}
+	if (cfg.HealthTLSCert == "") != (cfg.HealthTLSKey == "") {
+		return Config{}, errors.New("health_tls_cert and health_tls_key must be set together")
+	}
+	if cfg.HealthTLSCert != "" && strings.HasPrefix(cfg.HealthAddr, "unix:") {
+		return Config{}, errors.New("health_tls_cert is not supported with a unix socket health_addr")
+	}
+	if cfg.HealthFailingErrorRatio <= 0 || cfg.HealthFailingErrorRatio > 1 {
+		return Config{}, errors.New("health_failing_error_ratio must be > 0 and <= 1")
+	}
+	if cfg.HealthDegradedErrorRatio < 0 || cfg.HealthDegradedErrorRatio >= cfg.HealthFailingErrorRatio {
+		return Config{}, errors.New("health_degraded_error_ratio must be >= 0 and below health_failing_error_ratio")
+	}
+	if cfg.OTLPEndpoint != "" {
+		if _, err := tracing.NewOTLPExporter(cfg.OTLPEndpoint, nil); err != nil {
+			return Config{}, err
+		}
+	}
+	switch cfg.NotifySummary {
+	case notify.SummaryOff, notify.SummaryChanges, notify.SummaryAlways:
+	default:
+		return Config{}, fmt.Errorf("invalid notify_summary %q (expected off, changes or always)", cfg.NotifySummary)
+	}
+	cfg.Notifiers, err = resolveNotifiers(raw.Notify)
+	if err != nil {
+		return Config{}, err
+	}
+	if cfg.PlanFormat != "json" && cfg.PlanFormat != "csv" {
+		return Config{}, fmt.Errorf("invalid plan_format %q (expected json or csv)", cfg.PlanFormat)
+	}
 
 	seen := make(map[string]bool, len(raw.Destinations))
 	for i, rd := range raw.Destinations {
@@ -172,18 +437,64 @@ func resolve(raw rawConfig) (Config, error) {
 			}
 		}
 
+		if rd.ProtectDstRegex != "" {
+			if _, err := regexp.Compile(rd.ProtectDstRegex); err != nil {
+				return Config{}, fmt.Errorf("destination %q: protect_dst_regex: %w", name, err)
+			}
+		}
+
 		dryRun := raw.DryRun
 		if rd.DryRun != nil {
 			dryRun = *rd.DryRun
 		}
 
-		cfg.Destinations = append(cfg.Destinations, Destination{
+		dedupe := raw.Dedupe
+		if rd.Dedupe != nil {
+			dedupe = *rd.Dedupe
+		}
+
+		approvalOver := raw.DeleteApprovalOver
+		if rd.DeleteApprovalOver != nil {
+			approvalOver = rd.DeleteApprovalOver
+		}
+		if approvalOver != nil && *approvalOver < 0 {
+			return Config{}, fmt.Errorf("destination %q: delete_approval_over must be >= 0", name)
+		}
+
+		sched := globalSched
+		if rd.Interval != "" || rd.Schedule != "" {
+			sched, err = resolveSchedule(rd.Interval, rd.Schedule, nil)
+			if err != nil {
+				return Config{}, fmt.Errorf("destination %q: %w", name, err)
+			}
+		}
+		// Jitter past the gap to the next slot would make runs skip it.
+		if gap := schedule.MinGap(sched, time.Now()); cfg.Jitter > 0 && gap > 0 && cfg.Jitter >= gap {
+			return Config{}, fmt.Errorf("destination %q: jitter %s must be below the %s between its runs", name, cfg.Jitter, gap)
+		}
+		quiet := globalQuiet
+		if rd.QuietHours != nil {
+			quiet, err = schedule.ParseWindows(rd.QuietHours)
+			if err != nil {
+				return Config{}, fmt.Errorf("destination %q: quiet_hours: %w", name, err)
+			}
+		}
+
+		d := Destination{
 			Name:            name,
 			Token:           token,
 			Mode:            mode,
 			DryRun:          dryRun,
 			ProtectDstRegex: rd.ProtectDstRegex,
-		})
+			Dedupe:          dedupe,
+			Schedule:        sched,
+			QuietHours:      quiet,
+		}
+		if approvalOver != nil {
+			d.DeleteApproval = true
+			d.DeleteApprovalOver = *approvalOver
+		}
+		cfg.Destinations = append(cfg.Destinations, d)
 	}
 
 	if len(cfg.Destinations) == 0 {
@@ -193,6 +504,77 @@ func resolve(raw rawConfig) (Config, error) {
 	return cfg, nil
 }
 
+// resolveSchedule turns an interval or cron schedule into a Schedule. At most
+// one may be set; with neither, def is returned.
+func resolveSchedule(interval, cron string, def schedule.Schedule) (schedule.Schedule, error) {
+	interval, cron = strings.TrimSpace(interval), strings.TrimSpace(cron)
+	switch {
+	case interval != "" && cron != "":
+		return nil, errors.New("set interval or schedule, not both")
+	case cron != "":
+		c, err := schedule.ParseCron(cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule: %w", err)
+		}
+		if c.Next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("schedule %q never fires", cron)
+		}
+		return c, nil
+	case interval != "":
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("interval: %w", err)
+		}
+		if d < 10*time.Second {
+			return nil, errors.New("interval must be >= 10s")
+		}
+		return schedule.Every(d), nil
+	}
+	return def, nil
+}
+
+// resolveNotifiers validates notifier entries, filling the url and token
+// from NOTIFY_URL_<NAME> and NOTIFY_TOKEN_<NAME> when omitted. The name
+// defaults to the type.
+func resolveNotifiers(raw []rawNotifier) ([]notify.SinkConfig, error) {
+	out := make([]notify.SinkConfig, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for i, rn := range raw {
+		c := notify.SinkConfig{
+			Type:    strings.TrimSpace(rn.Type),
+			Name:    stringOr(rn.Name, strings.TrimSpace(rn.Type)),
+			ChatID:  strings.TrimSpace(rn.ChatID),
+			Targets: strings.TrimSpace(rn.Targets),
+		}
+		if c.Name == "" {
+			return nil, fmt.Errorf("notify[%d]: type is required", i)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("notifier %q: duplicate name (set distinct \"name\" fields)", c.Name)
+		}
+		seen[c.Name] = true
+		c.URL = stringOr(rn.URL, os.Getenv(notifyEnvKey("NOTIFY_URL_", c.Name)))
+		c.Token = stringOr(rn.Token, os.Getenv(notifyEnvKey("NOTIFY_TOKEN_", c.Name)))
+
+		for _, ev := range rn.Events {
+			k := notify.Kind(strings.TrimSpace(ev))
+			if !slices.Contains(notify.Kinds, k) {
+				return nil, fmt.Errorf("notifier %q: unknown event %q", c.Name, ev)
+			}
+			c.Kinds = append(c.Kinds, k)
+		}
+		if _, err := notify.NewSink(c, nil); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func notifyEnvKey(prefix, name string) string {
+	return prefix + strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(name))
+}
+
 func parseMode(s, def string) (syncer.Mode, error) {
 	if s == "" {
 		s = def
@@ -225,6 +607,13 @@ func durationOr(s string, def time.Duration) time.Duration {
 	return d
 }
 
+func floatOr(f *float64, def float64) float64 {
+	if f == nil {
+		return def
+	}
+	return *f
+}
+
 func intOr(n, def int) int {
 	if n <= 0 {
 		return def
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"log/slog"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -205,3 +207,400 @@ func TestResolveTokenEnvKeyFormat(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveRejectsInvalidProtectRegex(t *testing.T) {
+	writeConfig(t, `{
+		"src_token": "src",
+		"destinations": [{"name": "x", "token": "t", "protect_dst_regex": "[unclosed"}]
+	}`)
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for invalid protect_dst_regex")
+	}
+}
+
+func TestResolvePlanFormat(t *testing.T) {
+	writeConfig(t, `{
+		"src_token": "src",
+		"plan_dir": "/var/lib/rd-mirror-sync/plans",
+		"plan_format": "csv",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.PlanDir != "/var/lib/rd-mirror-sync/plans" || cfg.PlanFormat != "csv" {
+		t.Errorf("plan settings: got dir=%q format=%q", cfg.PlanDir, cfg.PlanFormat)
+	}
+
+	writeConfig(t, `{
+		"src_token": "src",
+		"plan_format": "xml",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for invalid plan_format")
+	}
+}
+
+func TestResolveDeleteApprovalOverride(t *testing.T) {
+	writeConfig(t, `{
+		"src_token": "src",
+		"delete_approval_over": 25,
+		"destinations": [
+			{"name": "a", "token": "t1"},
+			{"name": "b", "token": "t2", "delete_approval_over": 0}
+		]
+	}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	a, b := cfg.Destinations[0], cfg.Destinations[1]
+	if !a.DeleteApproval || a.DeleteApprovalOver != 25 {
+		t.Errorf("a: got approval=%v over=%d, want true/25", a.DeleteApproval, a.DeleteApprovalOver)
+	}
+	if !b.DeleteApproval || b.DeleteApprovalOver != 0 {
+		t.Errorf("b: got approval=%v over=%d, want true/0", b.DeleteApproval, b.DeleteApprovalOver)
+	}
+	if cfg.StateDir != defaultStateDir {
+		t.Errorf("state_dir: got %q, want %q", cfg.StateDir, defaultStateDir)
+	}
+}
+
+func TestResolveLogging(t *testing.T) {
+	writeConfig(t, `{
+		"src_token": "src",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.LogLevel != slog.LevelInfo || cfg.LogFormat != "text" {
+		t.Errorf("defaults: got level=%v format=%q", cfg.LogLevel, cfg.LogFormat)
+	}
+
+	t.Setenv("LOG_LEVEL", "debug")
+	writeConfig(t, `{
+		"src_token": "src",
+		"log_format": "json",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.LogLevel != slog.LevelDebug || cfg.LogFormat != "json" {
+		t.Errorf("got level=%v format=%q, want DEBUG/json", cfg.LogLevel, cfg.LogFormat)
+	}
+
+	for _, bad := range []string{`"log_level": "loud"`, `"log_format": "xml"`} {
+		writeConfig(t, `{
+			"src_token": "src", `+bad+`,
+			"destinations": [{"name": "x", "token": "t"}]
+		}`)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestResolveAuditLog(t *testing.T) {
+	writeConfig(t, `{
+		"src_token": "src",
+		"state_dir": "/var/lib/rd",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.AuditLog != "/var/lib/rd/audit.jsonl" || cfg.HistorySize != defaultHistorySize {
+		t.Errorf("defaults: audit_log=%q history_size=%d", cfg.AuditLog, cfg.HistorySize)
+	}
+
+	writeConfig(t, `{
+		"src_token": "src",
+		"audit_log": "off",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.AuditLog != "" {
+		t.Errorf("audit_log off: got %q", cfg.AuditLog)
+	}
+}
+
+func TestResolveNotifiers(t *testing.T) {
+	t.Setenv("NOTIFY_URL_OPS_DISCORD", "https://discord.example/api/webhooks/1/x")
+	writeConfig(t, `{
+		"src_token": "src",
+		"notify_summary": "changes",
+		"notify": [
+			{"type": "discord", "name": "ops-discord", "events": ["failing", "recovered"]},
+			{"type": "telegram", "token": "1:abc", "chat_id": "42"}
+		],
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Notifiers) != 2 {
+		t.Fatalf("got %d notifiers", len(cfg.Notifiers))
+	}
+	d, tg := cfg.Notifiers[0], cfg.Notifiers[1]
+	if d.URL != "https://discord.example/api/webhooks/1/x" || len(d.Kinds) != 2 {
+		t.Errorf("discord: %+v", d)
+	}
+	if tg.Name != "telegram" || tg.ChatID != "42" {
+		t.Errorf("telegram: %+v", tg)
+	}
+	if cfg.NotifyAfterFailures != defaultNotifyAfter || cfg.NotifyMinInterval != defaultNotifyMinInterval || cfg.NotifySummary != "changes" {
+		t.Errorf("notify settings: after=%d interval=%s summary=%q", cfg.NotifyAfterFailures, cfg.NotifyMinInterval, cfg.NotifySummary)
+	}
+
+	for _, bad := range []string{
+		`"notify": [{"type": "slack"}]`,
+		`"notify": [{"type": "slack", "url": "https://x", "events": ["everything"]}]`,
+		`"notify": [{"type": "ntfy", "url": "https://a"}, {"type": "ntfy", "url": "https://b"}]`,
+		`"notify_summary": "sometimes"`,
+	} {
+		writeConfig(t, `{"src_token": "src", `+bad+`, "destinations": [{"name": "x", "token": "t"}]}`)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestResolveHealthThresholds(t *testing.T) {
+	writeConfig(t, `{
+		"src_token": "src",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.HealthFailAfter != defaultHealthFail || cfg.HealthDegradedErrorRatio != 0 || cfg.HealthFailingErrorRatio != 1 {
+		t.Errorf("defaults: fail_after=%d degraded=%v failing=%v",
+			cfg.HealthFailAfter, cfg.HealthDegradedErrorRatio, cfg.HealthFailingErrorRatio)
+	}
+
+	writeConfig(t, `{
+		"src_token": "src",
+		"health_fail_after": 5,
+		"health_degraded_error_ratio": 0.1,
+		"health_failing_error_ratio": 0.5,
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.HealthFailAfter != 5 || cfg.HealthDegradedErrorRatio != 0.1 || cfg.HealthFailingErrorRatio != 0.5 {
+		t.Errorf("overrides: %+v", cfg)
+	}
+
+	for _, bad := range []string{
+		`"health_failing_error_ratio": 0`,
+		`"health_failing_error_ratio": 1.5`,
+		`"health_degraded_error_ratio": -0.1`,
+		`"health_degraded_error_ratio": 0.5, "health_failing_error_ratio": 0.5`,
+	} {
+		writeConfig(t, `{
+			"src_token": "src", `+bad+`,
+			"destinations": [{"name": "x", "token": "t"}]
+		}`)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestResolveSchedules(t *testing.T) {
+	writeConfig(t, `{
+		"src_token": "src",
+		"interval": "2m",
+		"quiet_hours": ["18:00-23:00"],
+		"destinations": [
+			{"name": "a", "token": "t"},
+			{"name": "b", "token": "t", "interval": "10m", "quiet_hours": []},
+			{"name": "c", "token": "t", "schedule": "0 3 * * *"}
+		]
+	}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	a, b, c := cfg.Destinations[0], cfg.Destinations[1], cfg.Destinations[2]
+	if a.Schedule.String() != "every 2m0s" || len(a.QuietHours) != 1 {
+		t.Errorf("a inherits globals: %s %v", a.Schedule, a.QuietHours)
+	}
+	if b.Schedule.String() != "every 10m0s" || len(b.QuietHours) != 0 {
+		t.Errorf("b overrides: %s %v", b.Schedule, b.QuietHours)
+	}
+	if c.Schedule.String() != "cron 0 3 * * *" || len(c.QuietHours) != 1 {
+		t.Errorf("c cron: %s %v", c.Schedule, c.QuietHours)
+	}
+
+	for _, bad := range []string{
+		`"schedule": "0 3 * *"`,
+		`"schedule": "0 0 30 2 *"`,
+		`"interval": "1m", "schedule": "@hourly"`,
+		`"quiet_hours": ["18:00"]`,
+	} {
+		writeConfig(t, `{
+			"src_token": "src", `+bad+`,
+			"destinations": [{"name": "x", "token": "t"}]
+		}`)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected error for global %s", bad)
+		}
+		writeConfig(t, `{
+			"src_token": "src",
+			"destinations": [{"name": "x", "token": "t", `+bad+`}]
+		}`)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected error for destination %s", bad)
+		}
+	}
+}
+
+func TestResolveSchedulingSpread(t *testing.T) {
+	writeConfig(t, `{
+		"src_token": "src",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.StartStagger != defaultStagger || cfg.Jitter != defaultJitter || cfg.BackoffMax != defaultBackoffMax {
+		t.Errorf("defaults: stagger=%s jitter=%s backoff_max=%s", cfg.StartStagger, cfg.Jitter, cfg.BackoffMax)
+	}
+
+	writeConfig(t, `{
+		"src_token": "src",
+		"start_stagger": "30s",
+		"jitter": "0",
+		"backoff_max": "0",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.StartStagger != 30*time.Second || cfg.Jitter != 0 || cfg.BackoffMax != 0 {
+		t.Errorf("overrides: stagger=%s jitter=%s backoff_max=%s", cfg.StartStagger, cfg.Jitter, cfg.BackoffMax)
+	}
+
+	writeConfig(t, `{
+		"src_token": "src",
+		"interval": "30s",
+		"jitter": "30s",
+		"destinations": [{"name": "x", "token": "t"}]
+	}`)
+	if _, err := Load(); err == nil {
+		t.Error("expected error for jitter >= interval")
+	}
+
+	for _, dest := range []string{
+		`{"name": "x", "token": "t", "interval": "30s"}`,
+		`{"name": "x", "token": "t", "schedule": "0,1 * * * *"}`,
+	} {
+		writeConfig(t, `{
+			"src_token": "src",
+			"interval": "10m",
+			"jitter": "1m",
+			"destinations": [`+dest+`]
+		}`)
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "between its runs") {
+			t.Errorf("%s: expected jitter error, got %v", dest, err)
+		}
+	}
+}
+
+func TestResolveDrainTimeout(t *testing.T) {
+	writeConfig(t, `{"src_token": "src", "destinations": [{"name": "x", "token": "t"}]}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.DrainTimeout != defaultDrain {
+		t.Errorf("default drain_timeout = %s", cfg.DrainTimeout)
+	}
+
+	writeConfig(t, `{"src_token": "src", "drain_timeout": "0", "destinations": [{"name": "x", "token": "t"}]}`)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.DrainTimeout != 0 {
+		t.Errorf("drain_timeout = %s, want 0", cfg.DrainTimeout)
+	}
+}
+
+func TestResolveFailureTracking(t *testing.T) {
+	writeConfig(t, `{"src_token": "src", "destinations": [{"name": "x", "token": "t"}]}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.FailureBackoff != defaultFailBackoff || cfg.FailureBackoffMax != defaultFailMax || cfg.QuarantineAfter != defaultQuarantine {
+		t.Errorf("defaults: backoff=%s max=%s quarantine_after=%d", cfg.FailureBackoff, cfg.FailureBackoffMax, cfg.QuarantineAfter)
+	}
+
+	writeConfig(t, `{"src_token": "src", "quarantine_after": 0, "failure_backoff": "1h", "failure_backoff_max": "1h",
+		"destinations": [{"name": "x", "token": "t"}]}`)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.QuarantineAfter != 0 || cfg.FailureBackoff != time.Hour {
+		t.Errorf("overrides: backoff=%s quarantine_after=%d", cfg.FailureBackoff, cfg.QuarantineAfter)
+	}
+
+	for _, bad := range []string{`"quarantine_after": -1`, `"failure_backoff": "2h", "failure_backoff_max": "1h"`} {
+		writeConfig(t, `{"src_token": "src", `+bad+`, "destinations": [{"name": "x", "token": "t"}]}`)
+		if _, err := Load(); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestResolveFullReconcile(t *testing.T) {
+	writeConfig(t, `{"src_token": "src", "destinations": [{"name": "x", "token": "t"}]}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.FullReconcile != defaultReconcile {
+		t.Errorf("default full_reconcile_interval = %s", cfg.FullReconcile)
+	}
+
+	writeConfig(t, `{"src_token": "src", "full_reconcile_interval": "0", "destinations": [{"name": "x", "token": "t"}]}`)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.FullReconcile != 0 {
+		t.Errorf("full_reconcile_interval = %s, want 0", cfg.FullReconcile)
+	}
+}
+
+func TestResolveDedupe(t *testing.T) {
+	writeConfig(t, `{"src_token": "src", "dedupe": true, "destinations": [
+		{"name": "a", "token": "t1"},
+		{"name": "b", "token": "t2", "dedupe": false}]}`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.Destinations[0].Dedupe || cfg.Destinations[1].Dedupe {
+		t.Errorf("dedupe = %v, %v; want true, false", cfg.Destinations[0].Dedupe, cfg.Destinations[1].Dedupe)
+	}
+}
@@ -0,0 +1,325 @@
+// Package failures remembers torrents whose adds keep failing on a
+// destination, so later runs back off from them and, after enough attempts,
+// quarantine them instead of retrying every interval.
+//
+// Each destination's records are stored as "<dir>/<dest>.json". A hash has a
+// record only while its adds are failing; a successful add or a manual clear
+// removes it. Changes hold an advisory lock on "<dir>/<dest>.lock", so the
+// daemon and the quarantine command can update the same file. Platforms
+// without flock skip that lock, and only one process may write there.
+package failures
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/syncer"
+)
+
+// Record is the failure history of one hash on one destination.
+type Record struct {
+	Hash          string    `json:"hash"`
+	Name          string    `json:"name"`
+	Attempts      int       `json:"attempts"`
+	FirstFailedAt time.Time `json:"first_failed_at"`
+	LastFailedAt  time.Time `json:"last_failed_at"`
+	LastError     string    `json:"last_error"`
+	// RetryAt is when the next add may be attempted; zero once quarantined.
+	RetryAt     time.Time `json:"retry_at,omitempty"`
+	Quarantined bool      `json:"quarantined"`
+}
+
+// Policy sets how failed adds are retried.
+type Policy struct {
+	// Backoff is the wait after the first failure; it doubles with every
+	// further failure, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// QuarantineAfter failed attempts stop further adds until the hash is
+	// cleared. 0 never quarantines.
+	QuarantineAfter int
+}
+
+// delay returns the wait after the given number of failed attempts.
+func (p Policy) delay(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// Store reads and writes failure records in a directory. It is safe for
+// concurrent use, and on platforms with flock from separate processes too:
+// every change locks the destination's lock file across its read and write,
+// so the CLI clearing a hash cannot undo a failure the daemon records at the
+// same time or be undone by it. Writes are atomic renames, so reads need no
+// lock.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewStore returns a Store rooted at dir. The directory is created on first write.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// List returns dest's records ordered by hash.
+func (s *Store) List(dest string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recs, err := s.read(dest)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Record, 0, len(recs))
+	for _, r := range recs {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Hash < out[j].Hash })
+	return out, nil
+}
+
+// Quarantined returns dest's quarantined records ordered by hash.
+func (s *Store) Quarantined(dest string) ([]Record, error) {
+	recs, err := s.List(dest)
+	if err != nil {
+		return nil, err
+	}
+	out := recs[:0]
+	for _, r := range recs {
+		if r.Quarantined {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// Clear forgets hash's failures on dest, or all of dest's when hash is
+// empty, so the next run tries the add again. It returns how many records
+// were removed.
+func (s *Store) Clear(dest, hash string) (int, error) {
+	unlock, err := s.lock(dest)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	recs, err := s.read(dest)
+	if err != nil {
+		return 0, err
+	}
+	n := len(recs)
+	if hash == "" {
+		recs = nil
+	} else {
+		delete(recs, normalizeHash(hash))
+	}
+	if n == len(recs) {
+		return 0, nil
+	}
+	return n - len(recs), s.write(dest, recs)
+}
+
+// lock takes s.mu and an exclusive lock on dest's lock file, waiting for
+// another process to finish its change first. The returned func releases
+// both.
+func (s *Store) lock(dest string) (func(), error) {
+	s.mu.Lock()
+	f, err := s.openLock(dest)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		f.Close()
+		s.mu.Unlock()
+	}, nil
+}
+
+func (s *Store) openLock(dest string) (*os.File, error) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.file(dest, ".lock"), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", f.Name(), err)
+	}
+	return f, nil
+}
+
+func (s *Store) path(dest string) string {
+	return s.file(dest, ".json")
+}
+
+func (s *Store) file(dest, ext string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, dest)
+	return filepath.Join(s.dir, safe+ext)
+}
+
+func (s *Store) read(dest string) (map[string]Record, error) {
+	path := s.path(dest)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]Record{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Record
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	recs := make(map[string]Record, len(list))
+	for _, r := range list {
+		recs[r.Hash] = r
+	}
+	return recs, nil
+}
+
+func (s *Store) write(dest string, recs map[string]Record) error {
+	if len(recs) == 0 {
+		err := os.Remove(s.path(dest))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	list := make([]Record, 0, len(recs))
+	for _, r := range recs {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Hash < list[j].Hash })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".failures-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(dest))
+}
+
+// Tracker is a syncer.FailureTracker for one destination.
+type Tracker struct {
+	store  *Store
+	dest   string
+	policy Policy
+}
+
+// NewTracker returns a tracker recording dest's failed adds in store.
+func NewTracker(store *Store, dest string, policy Policy) *Tracker {
+	return &Tracker{store: store, dest: dest, policy: policy}
+}
+
+func (t *Tracker) log() *slog.Logger {
+	return slog.With(logging.KeyDest, t.dest, logging.KeyOp, "add")
+}
+
+// Held implements syncer.FailureTracker.
+func (t *Tracker) Held(now time.Time) (map[string]string, error) {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	recs, err := t.store.read(t.dest)
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[string]string, len(recs))
+	for h, r := range recs {
+		switch {
+		case r.Quarantined:
+			held[h] = syncer.ReasonQuarantined
+		case now.Before(r.RetryAt):
+			held[h] = syncer.ReasonFailureBackoff
+		}
+	}
+	return held, nil
+}
+
+// AddFailed implements syncer.FailureTracker.
+func (t *Tracker) AddFailed(it syncer.PlanItem, cause error) error {
+	unlock, err := t.store.lock(t.dest)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	recs, err := t.store.read(t.dest)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	r, ok := recs[it.Hash]
+	if !ok {
+		r = Record{Hash: it.Hash, FirstFailedAt: now}
+	}
+	r.Name = it.Name
+	r.Attempts++
+	r.LastFailedAt = now
+	r.LastError = cause.Error()
+	if t.policy.QuarantineAfter > 0 && r.Attempts >= t.policy.QuarantineAfter {
+		r.Quarantined = true
+		r.RetryAt = time.Time{}
+		t.log().Warn("quarantined after repeated add failures", logging.KeyHash, it.Hash, "name", it.Name,
+			"attempts", r.Attempts, "clear_with", "rd-mirror-sync quarantine -dest "+t.dest+" -clear "+it.Hash)
+	} else {
+		r.RetryAt = now.Add(t.policy.delay(r.Attempts))
+		t.log().Info("backing off failing add", logging.KeyHash, it.Hash, "attempts", r.Attempts, "retry_at", r.RetryAt)
+	}
+	recs[it.Hash] = r
+	return t.store.write(t.dest, recs)
+}
+
+// AddSucceeded implements syncer.FailureTracker.
+func (t *Tracker) AddSucceeded(hash string) error {
+	unlock, err := t.store.lock(t.dest)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	recs, err := t.store.read(t.dest)
+	if err != nil {
+		return err
+	}
+	if _, ok := recs[hash]; !ok {
+		return nil
+	}
+	delete(recs, hash)
+	return t.store.write(t.dest, recs)
+}
+
+func normalizeHash(h string) string {
+	return strings.ToLower(strings.TrimSpace(h))
+}
@@ -0,0 +1,94 @@
+package failures
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+func TestTrackerBacksOffThenQuarantines(t *testing.T) {
+	store := NewStore(t.TempDir())
+	tr := NewTracker(store, "a", Policy{Backoff: time.Minute, MaxBackoff: 3 * time.Minute, QuarantineAfter: 4})
+	it := syncer.PlanItem{Hash: "abc", Name: "Bad"}
+	cause := errors.New("status=451")
+
+	var retryAts []time.Duration
+	for i := 0; i < 3; i++ {
+		before := time.Now()
+		if err := tr.AddFailed(it, cause); err != nil {
+			t.Fatal(err)
+		}
+		recs, err := store.List("a")
+		if err != nil || len(recs) != 1 {
+			t.Fatalf("List: %v %+v", err, recs)
+		}
+		retryAts = append(retryAts, recs[0].RetryAt.Sub(before).Round(time.Minute))
+
+		held, err := tr.Held(before)
+		if err != nil || held["abc"] != syncer.ReasonFailureBackoff {
+			t.Fatalf("attempt %d: held %v, err %v", i+1, held, err)
+		}
+		if held, _ := tr.Held(recs[0].RetryAt); len(held) != 0 {
+			t.Fatalf("attempt %d: still held after retry_at: %v", i+1, held)
+		}
+	}
+	if want := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}; retryAts[0] != want[0] || retryAts[1] != want[1] || retryAts[2] != want[2] {
+		t.Fatalf("backoff %v, want %v", retryAts, want)
+	}
+
+	if err := tr.AddFailed(it, cause); err != nil {
+		t.Fatal(err)
+	}
+	q, err := store.Quarantined("a")
+	if err != nil || len(q) != 1 || q[0].Attempts != 4 || q[0].LastError != "status=451" || !q[0].RetryAt.IsZero() {
+		t.Fatalf("quarantined: %v %+v", err, q)
+	}
+	if held, _ := tr.Held(time.Now().Add(365 * 24 * time.Hour)); held["abc"] != syncer.ReasonQuarantined {
+		t.Fatalf("quarantine should not expire: %v", held)
+	}
+
+	n, err := store.Clear("a", " ABC ")
+	if err != nil || n != 1 {
+		t.Fatalf("Clear: %d, %v", n, err)
+	}
+	if held, _ := tr.Held(time.Now()); len(held) != 0 {
+		t.Fatalf("held after clear: %v", held)
+	}
+}
+
+func TestTrackerSuccessForgetsFailures(t *testing.T) {
+	store := NewStore(t.TempDir())
+	a := NewTracker(store, "a", Policy{Backoff: time.Hour, MaxBackoff: time.Hour})
+	b := NewTracker(store, "b", Policy{Backoff: time.Hour, MaxBackoff: time.Hour})
+	for _, h := range []string{"x", "y"} {
+		if err := a.AddFailed(syncer.PlanItem{Hash: h}, errors.New("boom")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.AddFailed(syncer.PlanItem{Hash: "x"}, errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.AddSucceeded("x"); err != nil {
+		t.Fatal(err)
+	}
+	if recs, _ := store.List("a"); len(recs) != 1 || recs[0].Hash != "y" {
+		t.Fatalf("a: %+v", recs)
+	}
+	if recs, _ := store.List("b"); len(recs) != 1 {
+		t.Fatalf("destinations must be tracked separately: %+v", recs)
+	}
+	// Without QuarantineAfter nothing is ever quarantined.
+	if q, _ := store.Quarantined("a"); len(q) != 0 {
+		t.Fatalf("quarantined: %+v", q)
+	}
+
+	if n, err := store.Clear("a", ""); err != nil || n != 1 {
+		t.Fatalf("Clear all: %d, %v", n, err)
+	}
+	if recs, _ := store.List("a"); len(recs) != 0 {
+		t.Fatalf("a after clear: %+v", recs)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package failures
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+func TestChangesWaitForOtherProcess(t *testing.T) {
+	dir := t.TempDir()
+	daemon := NewTracker(NewStore(dir), "a", Policy{Backoff: time.Minute, MaxBackoff: time.Hour})
+	if err := daemon.AddFailed(syncer.PlanItem{Hash: "abc"}, errors.New("status=451")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second Store opens its own lock file, as the CLI would.
+	cli := NewStore(dir)
+	f, err := cli.openLock("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- daemon.AddFailed(syncer.PlanItem{Hash: "def"}, errors.New("status=451")) }()
+	select {
+	case err := <-done:
+		t.Fatalf("AddFailed did not wait for the lock: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	f.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := cli.Clear("a", "abc"); err != nil || n != 1 {
+		t.Fatalf("Clear: %d, %v", n, err)
+	}
+	recs, err := cli.List("a")
+	if err != nil || len(recs) != 1 || recs[0].Hash != "def" {
+		t.Fatalf("records: %+v, %v", recs, err)
+	}
+}
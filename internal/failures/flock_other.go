@@ -0,0 +1,9 @@
+//go:build !unix
+
+package failures
+
+import "os"
+
+// lockFile has no advisory lock to take here, so only the Store's mutex
+// orders changes, and a CLI clear can race the daemon's writes.
+func lockFile(*os.File) error { return nil }
@@ -0,0 +1,13 @@
+//go:build unix
+
+package failures
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile waits for an exclusive flock on f. Closing f releases it.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
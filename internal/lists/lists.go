@@ -0,0 +1,208 @@
+// Package lists persists per-destination hash lists that override the sync
+// plan: ignored hashes are never added to the destination and pinned hashes
+// are never deleted from it.
+//
+// Each destination's lists are stored as "<dir>/<dest>.json". The CLI and
+// the admin API edit the files directly, and runners read them at the start
+// of every run, so changes apply from the next run without a restart.
+package lists
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// List names.
+const (
+	Ignore = "ignore" // never add
+	Pin    = "pin"    // never delete
+)
+
+// ErrInvalidHash is returned when a hash is empty or not hexadecimal.
+var ErrInvalidHash = errors.New("hash must be hexadecimal")
+
+// ErrUnknownList is returned for a list name other than Ignore or Pin.
+var ErrUnknownList = errors.New("list must be ignore or pin")
+
+// Entry is one hash on a list.
+type Entry struct {
+	Hash    string    `json:"hash"`
+	Note    string    `json:"note,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Lists are a destination's ignore and pin lists, each ordered by hash.
+type Lists struct {
+	Ignore []Entry `json:"ignore"`
+	Pin    []Entry `json:"pin"`
+}
+
+func (l *Lists) list(name string) *[]Entry {
+	if name == Pin {
+		return &l.Pin
+	}
+	return &l.Ignore
+}
+
+// Store reads and writes hash lists in a directory. It is safe for
+// concurrent use within one process; writes are atomic renames so the CLI
+// cannot leave a half-written file for the daemon.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewStore returns a Store rooted at dir. The directory is created on first write.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Get returns dest's lists; both are empty when none were saved.
+func (s *Store) Get(dest string) (Lists, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(dest)
+}
+
+// Add puts hash on dest's list, replacing the note if it is already there.
+// It reports whether the hash was new to the list.
+func (s *Store) Add(dest, list, hash, note string) (bool, error) {
+	hash, err := check(list, hash)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := s.read(dest)
+	if err != nil {
+		return false, err
+	}
+	entries := l.list(list)
+	for i, e := range *entries {
+		if e.Hash == hash {
+			(*entries)[i].Note = note
+			return false, s.write(dest, l)
+		}
+	}
+	*entries = append(*entries, Entry{Hash: hash, Note: note, AddedAt: time.Now().UTC()})
+	sort.Slice(*entries, func(i, j int) bool { return (*entries)[i].Hash < (*entries)[j].Hash })
+	return true, s.write(dest, l)
+}
+
+// Remove takes hash off dest's list and reports whether it was there.
+func (s *Store) Remove(dest, list, hash string) (bool, error) {
+	hash, err := check(list, hash)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := s.read(dest)
+	if err != nil {
+		return false, err
+	}
+	entries := l.list(list)
+	for i, e := range *entries {
+		if e.Hash == hash {
+			*entries = append((*entries)[:i], (*entries)[i+1:]...)
+			return true, s.write(dest, l)
+		}
+	}
+	return false, nil
+}
+
+// check validates list and returns hash normalized.
+func check(list, hash string) (string, error) {
+	if list != Ignore && list != Pin {
+		return "", ErrUnknownList
+	}
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if hash == "" || strings.Trim(hash, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("%q: %w", hash, ErrInvalidHash)
+	}
+	return hash, nil
+}
+
+func (s *Store) path(dest string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, dest)
+	return filepath.Join(s.dir, safe+".json")
+}
+
+func (s *Store) read(dest string) (Lists, error) {
+	l := Lists{Ignore: []Entry{}, Pin: []Entry{}}
+	path := s.path(dest)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(data, &l); err != nil {
+		return l, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func (s *Store) write(dest string, l Lists) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".lists-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(dest))
+}
+
+// Source is a syncer.HashLists for one destination.
+type Source struct {
+	store *Store
+	dest  string
+}
+
+// NewSource returns dest's lists from store as a syncer.HashLists.
+func NewSource(store *Store, dest string) *Source {
+	return &Source{store: store, dest: dest}
+}
+
+// Load implements syncer.HashLists.
+func (s *Source) Load() (ignore, pin map[string]bool, err error) {
+	l, err := s.store.Get(s.dest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return set(l.Ignore), set(l.Pin), nil
+}
+
+func set(entries []Entry) map[string]bool {
+	m := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		m[e.Hash] = true
+	}
+	return m
+}
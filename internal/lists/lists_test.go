@@ -0,0 +1,55 @@
+package lists
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStoreAddRemove(t *testing.T) {
+	s := NewStore(t.TempDir())
+
+	if added, err := s.Add("a", Ignore, " ABC123 ", "bad release"); err != nil || !added {
+		t.Fatalf("Add: %v %v", added, err)
+	}
+	if added, err := s.Add("a", Ignore, "abc123", "renamed note"); err != nil || added {
+		t.Fatalf("re-Add: %v %v", added, err)
+	}
+	if _, err := s.Add("a", Pin, "0f", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := s.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Ignore) != 1 || l.Ignore[0].Hash != "abc123" || l.Ignore[0].Note != "renamed note" || len(l.Pin) != 1 {
+		t.Fatalf("unexpected lists: %+v", l)
+	}
+	if other, _ := s.Get("b"); len(other.Ignore)+len(other.Pin) != 0 {
+		t.Fatalf("lists leaked to another destination: %+v", other)
+	}
+
+	ignore, pin, err := NewSource(s, "a").Load()
+	if err != nil || !ignore["abc123"] || !pin["0f"] || ignore["0f"] {
+		t.Fatalf("Load: ignore=%v pin=%v err=%v", ignore, pin, err)
+	}
+
+	if removed, err := s.Remove("a", Ignore, "ABC123"); err != nil || !removed {
+		t.Fatalf("Remove: %v %v", removed, err)
+	}
+	if removed, err := s.Remove("a", Ignore, "abc123"); err != nil || removed {
+		t.Fatalf("second Remove: %v %v", removed, err)
+	}
+}
+
+func TestStoreRejectsBadInput(t *testing.T) {
+	s := NewStore(t.TempDir())
+	if _, err := s.Add("a", "block", "abc", ""); !errors.Is(err, ErrUnknownList) {
+		t.Fatalf("unknown list: %v", err)
+	}
+	for _, h := range []string{"", "not-a-hash", "abc xyz"} {
+		if _, err := s.Add("a", Pin, h, ""); !errors.Is(err, ErrInvalidHash) {
+			t.Fatalf("%q: %v", h, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package lock keeps two rd-mirror-sync processes from syncing the same
+// destination account at once.
+//
+// A lock is an exclusive advisory lock (flock) on "<dir>/<fingerprint>.lock",
+// held on an open file for as long as the lock is. The fingerprint is derived
+// from the destination token, so the lock covers the account however the
+// destination is named in each process's config. The operating system drops
+// the lock when its process exits, however it exits, so a lock is never left
+// stale; the owner's PID, host and destination written into the file only
+// serve error messages. Platforms without flock only get the in-process
+// check, so there a second process is not kept out.
+package lock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrLocked is wrapped by the error Acquire returns when another live
+// process, or this one, holds the lock.
+var ErrLocked = errors.New("destination is locked")
+
+// Owner describes the process holding a lock.
+type Owner struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Dest      string    `json:"dest"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// HeldError reports who holds a lock Acquire could not take.
+type HeldError struct {
+	Path  string
+	Owner Owner
+}
+
+func (e *HeldError) Error() string {
+	if e.Owner.PID == 0 {
+		return fmt.Sprintf("%s: %s is held by another process", ErrLocked, e.Path)
+	}
+	return fmt.Sprintf("%s: held by pid %d on %s (destination %q) since %s; stop that process first",
+		ErrLocked, e.Owner.PID, e.Owner.Host, e.Owner.Dest, e.Owner.StartedAt.Format(time.RFC3339))
+}
+
+func (e *HeldError) Unwrap() error { return ErrLocked }
+
+// Lock is a held destination lock.
+type Lock struct {
+	path string
+	f    *os.File
+}
+
+// held tracks the lock files this process holds, so two destinations sharing
+// a token get an error saying so rather than one naming our own PID.
+var (
+	heldMu sync.Mutex
+	held   = map[string]string{} // path -> dest
+)
+
+// Fingerprint returns a short, non-reversible identifier for token.
+func Fingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Acquire takes the lock for the destination account identified by token.
+// dest only labels the lock for error messages.
+func Acquire(dir, dest, token string) (*Lock, error) {
+	path := filepath.Join(dir, Fingerprint(token)+".lock")
+
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	if other, ok := held[path]; ok {
+		return nil, fmt.Errorf("%w: destinations %q and %q use the same token", ErrLocked, other, dest)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	// The file is never removed, so every process locks the same inode.
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := tryLock(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	if !ok {
+		f.Close()
+		return nil, &HeldError{Path: path, Owner: readOwner(path)}
+	}
+
+	host, _ := os.Hostname()
+	data, err := json.Marshal(Owner{PID: os.Getpid(), Host: host, Dest: dest, StartedAt: time.Now().UTC()})
+	if err == nil {
+		err = f.Truncate(0)
+	}
+	if err == nil {
+		_, err = f.WriteAt(data, 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	held[path] = dest
+	return &Lock{path: path, f: f}, nil
+}
+
+// readOwner returns the owner recorded in path, or the zero Owner when it
+// cannot be read, e.g. because the owner is still writing it.
+func readOwner(path string) Owner {
+	var o Owner
+	data, err := os.ReadFile(path)
+	if err == nil {
+		_ = json.Unmarshal(data, &o)
+	}
+	return o
+}
+
+// Path returns the lock file's path.
+func (l *Lock) Path() string { return l.path }
+
+// Release clears the owner from the lock file and unlocks it.
+func (l *Lock) Release() error {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	delete(held, l.path)
+
+	err := l.f.Truncate(0)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
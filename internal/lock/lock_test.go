@@ -0,0 +1,70 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeOwner(t *testing.T, path string, o Owner) {
+	t.Helper()
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Acquire(dir, "a", "token-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := readOwner(l.Path()); o.PID != os.Getpid() || o.Dest != "a" {
+		t.Fatalf("owner = %+v", o)
+	}
+	if _, err := Acquire(dir, "b", "token-a"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("same token twice in one process: %v", err)
+	}
+	other, err := Acquire(dir, "b", "token-b")
+	if err != nil {
+		t.Fatalf("different token: %v", err)
+	}
+	defer other.Release()
+
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if o := readOwner(l.Path()); o.PID != 0 {
+		t.Fatalf("owner left after release: %+v", o)
+	}
+	l, err = Acquire(dir, "a", "token-a")
+	if err != nil {
+		t.Fatalf("re-acquire after release: %v", err)
+	}
+	l.Release()
+}
+
+// TestAcquireIgnoresLeftoverOwner covers a lock file left by a process that
+// is gone, e.g. one in a container since recreated under another hostname:
+// nothing holds the file locked, so it is taken over.
+func TestAcquireIgnoresLeftoverOwner(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, Fingerprint("tok")+".lock")
+	writeOwner(t, path, Owner{PID: 1, Host: "old-container", Dest: "other", StartedAt: time.Now()})
+
+	l, err := Acquire(dir, "a", "tok")
+	if err != nil {
+		t.Fatalf("leftover lock file not taken over: %v", err)
+	}
+	defer l.Release()
+	if o := readOwner(path); o.PID != os.Getpid() || o.Dest != "a" {
+		t.Fatalf("owner = %+v", o)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAcquireConflict(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, Fingerprint("tok")+".lock")
+	writeOwner(t, path, Owner{PID: 4242, Host: "elsewhere", Dest: "other", StartedAt: time.Now()})
+
+	// Another open file holding the flock stands in for another process.
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Acquire(dir, "a", "tok")
+	var held *HeldError
+	if !errors.As(err, &held) || !errors.Is(err, ErrLocked) || held.Owner.PID != 4242 || held.Owner.Dest != "other" {
+		t.Fatalf("held lock: %v", err)
+	}
+
+	// Closing the file drops the lock, as the owner exiting would.
+	f.Close()
+	l, err := Acquire(dir, "a", "tok")
+	if err != nil {
+		t.Fatalf("lock not taken once released: %v", err)
+	}
+	l.Release()
+}
@@ -0,0 +1,71 @@
+// Package logging configures the process-wide slog logger and defines the
+// attribute keys shared by every package, so one destination's lines can be
+// filtered with e.g. `journalctl -o cat | jq 'select(.dest=="x")'`.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Attribute keys used across packages.
+const (
+	KeyDest      = "dest"
+	KeyHash      = "hash"
+	KeyTorrentID = "torrent_id"
+	KeyOp        = "op"
+	KeyAttempt   = "attempt"
+	KeyErr       = "err"
+)
+
+// Formats accepted by New.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseLevel parses debug, info, warn or error (case-insensitive).
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (expected debug, info, warn or error)", s)
+	}
+	return l, nil
+}
+
+// New returns a logger writing to w at level in the given format.
+func New(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (expected text or json)", format)
+	}
+}
+
+// Err is shorthand for the error attribute.
+func Err(err error) slog.Attr {
+	return slog.Any(KeyErr, err)
+}
+
+type ctxKey struct{}
+
+// NewContext returns ctx carrying l, so code called with ctx (like the API
+// client) logs with the caller's fields such as dest.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger stored by NewContext, or slog.Default().
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok && l != nil {
+		return l
+	}
+	return slog.Default()
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, " warn ": slog.LevelWarn, "error": slog.LevelError} {
+		got, err := ParseLevel(in)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestNewJSONFiltersByLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, slog.LevelWarn, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = l.With(KeyDest, "loc1")
+	l.Info("hidden")
+	l.Warn("shown", KeyHash, "abc", Err(errors.New("boom")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %q", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["msg"] != "shown" || rec[KeyDest] != "loc1" || rec[KeyHash] != "abc" || rec[KeyErr] != "boom" {
+		t.Fatalf("unexpected record: %v", rec)
+	}
+
+	if _, err := New(&buf, slog.LevelInfo, "xml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Fatal("want slog.Default() without a context logger")
+	}
+	l := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	if FromContext(NewContext(context.Background(), l)) != l {
+		t.Fatal("context logger not returned")
+	}
+}
@@ -0,0 +1,314 @@
+// Package metrics is a small, dependency-free implementation of the
+// Prometheus text exposition format: counters, histograms and gauges whose
+// values are computed at scrape time.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds suited to HTTP calls.
+var DefBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20}
+
+// collector is a metric family that can write itself in text format.
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Registry holds metric families and renders them for /metrics.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText writes every registered family in Prometheus text format 0.0.4.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	cs := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range cs {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContentType is the Content-Type for WriteText output.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d desc) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.typ)
+	return err
+}
+
+// series renders name{labels} with the given extra label appended, if any.
+func (d desc) series(name string, values []string, extraName, extraValue string) string {
+	if len(d.labels) == 0 && extraName == "" {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, l := range d.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(d.labels) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(extraValue))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func (d desc) check(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+}
+
+const keySep = "\xff"
+
+// CounterVec is a monotonically increasing counter partitioned by labels.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec registers a counter family. Names should end in "_total".
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, "counter", labels}, values: make(map[string]float64)}
+	r.register(name, c)
+	return c
+}
+
+// Add increases the counter for the label values by v, which must be >= 0.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	c.check(labelValues)
+	if v < 0 {
+		panic("metrics: counter " + c.name + " cannot decrease")
+	}
+	c.mu.Lock()
+	c.values[strings.Join(labelValues, keySep)] += v
+	c.mu.Unlock()
+}
+
+// Inc increases the counter for the label values by one.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current count for the label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, keySep)]
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	keys := sortedKeys(c.values)
+	vals := make([]float64, len(keys))
+	for i, k := range keys {
+		vals[i] = c.values[k]
+	}
+	c.mu.Unlock()
+
+	if err := c.header(w); err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if _, err := fmt.Fprintf(w, "%s %s\n", c.series(c.name, splitKey(k, len(c.labels)), "", ""), formatFloat(vals[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec tracks observations in cumulative buckets, partitioned by labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, non-cumulative; last entry is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a histogram family with the given upper bounds.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	h := &HistogramVec{desc: desc{name, help, "histogram", labels}, buckets: b, values: make(map[string]*histogram)}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v for the label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.check(labelValues)
+	key := strings.Join(labelValues, keySep)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.values[key] = hist
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	hist.counts[i]++
+	hist.sum += v
+	hist.count++
+}
+
+// Count returns the number of observations for the label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hist, ok := h.values[strings.Join(labelValues, keySep)]; ok {
+		return hist.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.header(w); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		hist := h.values[k]
+		lv := splitKey(k, len(h.labels))
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += hist.counts[i]
+			if _, err := fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", lv, "le", formatFloat(ub)), cum); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", lv, "le", "+Inf"), hist.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n", h.series(h.name+"_sum", lv, "", ""), formatFloat(hist.sum)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_count", lv, "", ""), hist.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeFunc is a gauge family whose samples are produced at scrape time.
+type GaugeFunc struct {
+	desc
+	collect func(emit func(v float64, labelValues ...string))
+}
+
+// NewGaugeFunc registers a gauge family. collect is called on every scrape
+// and must call emit once per label set.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(emit func(v float64, labelValues ...string))) {
+	r.register(name, &GaugeFunc{desc: desc{name, help, "gauge", labels}, collect: collect})
+}
+
+func (g *GaugeFunc) write(w io.Writer) error {
+	if err := g.header(w); err != nil {
+		return err
+	}
+	var werr error
+	g.collect(func(v float64, labelValues ...string) {
+		g.check(labelValues)
+		if werr != nil {
+			return
+		}
+		_, werr = fmt.Fprintf(w, "%s %s\n", g.series(g.name, labelValues, "", ""), formatFloat(v))
+	})
+	return werr
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitKey(k string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	return strings.SplitN(k, keySep, n)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
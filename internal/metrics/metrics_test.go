@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTextFormat(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounterVec("x_total", "Things.", "dest")
+	c.Inc("a")
+	c.Add(2, `we"ird`)
+	h := reg.NewHistogramVec("x_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "GET /t")
+	h.Observe(0.5, "GET /t")
+	h.Observe(3, "GET /t")
+	reg.NewGaugeFunc("x_up", "Up.", nil, func(emit func(float64, ...string)) { emit(1) })
+
+	var buf bytes.Buffer
+	if err := reg.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	want := []string{
+		"# HELP x_total Things.",
+		"# TYPE x_total counter",
+		`x_total{dest="a"} 1`,
+		`x_total{dest="we\"ird"} 2`,
+		"# TYPE x_seconds histogram",
+		`x_seconds_bucket{route="GET /t",le="0.1"} 1`,
+		`x_seconds_bucket{route="GET /t",le="1"} 2`,
+		`x_seconds_bucket{route="GET /t",le="+Inf"} 3`,
+		`x_seconds_sum{route="GET /t"} 3.55`,
+		`x_seconds_count{route="GET /t"} 3`,
+		"# TYPE x_up gauge",
+		"x_up 1",
+	}
+	out := buf.String()
+	for _, line := range want {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing line %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounterVec("dup_total", "x")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on duplicate metric name")
+		}
+	}()
+	reg.NewCounterVec("dup_total", "x")
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"runtime"
+	"strconv"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+// Sync holds rd-mirror-sync's cumulative metrics. It implements
+// rdapi.Observer so the API client can report requests and retries.
+type Sync struct {
+	runs        *CounterVec
+	added       *CounterVec
+	resumed     *CounterVec
+	deleted     *CounterVec
+	errors      *CounterVec
+	runDuration *HistogramVec
+	skipped     *CounterVec
+	restarts    *CounterVec
+	incomplete  *CounterVec
+
+	apiRequests *CounterVec
+	apiRetries  *CounterVec
+	apiLatency  *HistogramVec
+}
+
+// Error kinds for rd_mirror_errors_total.
+const (
+	ErrorKindRun    = "run"
+	ErrorKindAdd    = "add"
+	ErrorKindDelete = "delete"
+)
+
+// Reasons for rd_mirror_skipped_runs_total.
+const (
+	SkipOverlap = "overlap" // the slot passed while the previous run was going
+	SkipBackoff = "backoff" // skipped to back off after failed runs
+	SkipPaused  = "paused"  // the destination was paused
+)
+
+// NewSync registers the application metrics on reg, including
+// rd_mirror_build_info for version.
+func NewSync(reg *Registry, version string) *Sync {
+	reg.NewGaugeFunc("rd_mirror_build_info", "Build information; always 1.", []string{"version", "goversion"},
+		func(emit func(float64, ...string)) { emit(1, version, runtime.Version()) })
+
+	return &Sync{
+		runs: reg.NewCounterVec("rd_mirror_runs_total",
+			"Sync runs completed, by result (ok or error).", "dest", "result"),
+		added: reg.NewCounterVec("rd_mirror_added_total",
+			"Torrents added to the destination.", "dest"),
+		resumed: reg.NewCounterVec("rd_mirror_resumed_total",
+			"Earlier adds whose file selection was completed on a later run.", "dest"),
+		deleted: reg.NewCounterVec("rd_mirror_deleted_total",
+			"Torrents deleted from the destination.", "dest"),
+		errors: reg.NewCounterVec("rd_mirror_errors_total",
+			"Sync errors by kind: run (the run failed), add or delete (a single item failed).", "dest", "kind"),
+		runDuration: reg.NewHistogramVec("rd_mirror_run_duration_seconds",
+			"Wall-clock duration of sync runs.", []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200}, "dest"),
+		skipped: reg.NewCounterVec("rd_mirror_skipped_runs_total",
+			"Runs not started, by reason: overlap, backoff or paused.", "dest", "reason"),
+		restarts: reg.NewCounterVec("rd_mirror_worker_restarts_total",
+			"Destination workers restarted after a panic.", "dest"),
+		incomplete: reg.NewCounterVec("rd_mirror_incomplete_listings_total",
+			"Runs whose library listing disagreed with Real-Debrid's count; their deletes were held back.", "dest"),
+		apiRequests: reg.NewCounterVec("rd_mirror_api_requests_total",
+			"Real-Debrid API HTTP attempts by route and status code (0 = no response).", "route", "code"),
+		apiRetries: reg.NewCounterVec("rd_mirror_api_retries_total",
+			"Real-Debrid API retries by route.", "route"),
+		apiLatency: reg.NewHistogramVec("rd_mirror_api_request_duration_seconds",
+			"Real-Debrid API attempt latency by route.", DefBuckets, "route"),
+	}
+}
+
+// ObserveRequest implements rdapi.Observer.
+func (s *Sync) ObserveRequest(route string, code int, elapsed time.Duration) {
+	s.apiRequests.Inc(route, strconv.Itoa(code))
+	s.apiLatency.Observe(elapsed.Seconds(), route)
+}
+
+// ObserveRetry implements rdapi.Observer.
+func (s *Sync) ObserveRetry(route string) {
+	s.apiRetries.Inc(route)
+}
+
+// RecordRun adds a finished run's results to the counters.
+func (s *Sync) RecordRun(dest string, stats syncer.Stats, err error, elapsed time.Duration) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+		s.errors.Inc(dest, ErrorKindRun)
+	}
+	s.runs.Inc(dest, result)
+	s.runDuration.Observe(elapsed.Seconds(), dest)
+	s.added.Add(float64(stats.Added), dest)
+	s.resumed.Add(float64(stats.Resumed), dest)
+	s.deleted.Add(float64(stats.Deleted+stats.Deduped), dest)
+	s.errors.Add(float64(stats.AddErrors), dest, ErrorKindAdd)
+	s.errors.Add(float64(stats.DeleteErrors), dest, ErrorKindDelete)
+	if stats.IncompleteListing {
+		s.incomplete.Inc(dest)
+	}
+}
+
+// RecordRestart counts a restart of dest's worker after a panic.
+func (s *Sync) RecordRestart(dest string) {
+	s.restarts.Inc(dest)
+}
+
+// RecordSkipped counts n runs of dest that did not start, for reason.
+func (s *Sync) RecordSkipped(dest, reason string, n int) {
+	s.skipped.Add(float64(n), dest, reason)
+}
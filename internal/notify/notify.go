@@ -0,0 +1,212 @@
+// Package notify sends alerts about destinations to chat and push services.
+//
+// A Notifier fans events out to Sinks (webhook, Discord, Slack, ntfy,
+// Apprise, Telegram) on a background goroutine, rate limited per destination
+// and event kind. A Watcher per destination turns run results into events:
+// health transitions, repeated add/delete errors, delete-approval
+// guard trips and optional run summaries.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/syncer"
+)
+
+// Kind identifies what an event is about. Sinks can subscribe to a subset.
+type Kind string
+
+const (
+	KindFailing     Kind = "failing"      // the destination's health turned failing
+	KindDegraded    Kind = "degraded"     // the destination's health went from ok to degraded
+	KindRecovered   Kind = "recovered"    // health is ok again after KindFailing or KindDegraded
+	KindItemErrors  Kind = "item_errors"  // adds or deletes kept failing in consecutive runs
+	KindDeleteGuard Kind = "delete_guard" // a mirror-delete plan is held for approval
+	KindSummary     Kind = "summary"      // a run finished (see SummaryMode)
+	KindTest        Kind = "test"         // sent by "rd-mirror-sync notify-test"
+)
+
+// Kinds lists every event kind, for validation.
+var Kinds = []Kind{KindFailing, KindDegraded, KindRecovered, KindItemErrors, KindDeleteGuard, KindSummary, KindTest}
+
+// DefaultKinds are the kinds a sink receives when it lists none.
+var DefaultKinds = []Kind{KindFailing, KindDegraded, KindRecovered, KindItemErrors, KindDeleteGuard, KindTest}
+
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Event is one notification.
+type Event struct {
+	Kind     Kind          `json:"kind"`
+	Severity Severity      `json:"severity"`
+	Dest     string        `json:"dest"`
+	Title    string        `json:"title"`
+	Message  string        `json:"message"`
+	Time     time.Time     `json:"time"`
+	Stats    *syncer.Stats `json:"stats,omitempty"`
+}
+
+// Sink delivers events to one service.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, e Event) error
+}
+
+// Route is a sink and the kinds of events it receives.
+type Route struct {
+	Sink  Sink
+	Kinds []Kind
+}
+
+func (r Route) wants(k Kind) bool {
+	kinds := r.Kinds
+	if len(kinds) == 0 {
+		kinds = DefaultKinds
+	}
+	for _, x := range kinds {
+		if x == k {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	queueSize   = 64
+	sendTimeout = 15 * time.Second
+)
+
+// Notifier delivers events to routes in the background. A nil *Notifier
+// drops everything, so callers need not check whether notifications are
+// configured.
+type Notifier struct {
+	routes      []Route
+	minInterval time.Duration
+
+	mu     sync.Mutex
+	last   map[string]time.Time
+	now    func() time.Time
+	closed bool
+
+	queue chan Event
+	done  chan struct{}
+}
+
+// New returns a Notifier sending to routes. Events with the same destination
+// and kind are sent at most once per minInterval; KindTest is never limited.
+func New(routes []Route, minInterval time.Duration) *Notifier {
+	n := &Notifier{
+		routes:      routes,
+		minInterval: minInterval,
+		last:        make(map[string]time.Time),
+		now:         time.Now,
+		queue:       make(chan Event, queueSize),
+		done:        make(chan struct{}),
+	}
+	go n.loop()
+	return n
+}
+
+// Notify queues e for delivery. It never blocks: when the rate limit
+// suppresses e or the queue is full, e is dropped.
+func (n *Notifier) Notify(e Event) {
+	if n == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = n.now()
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	if !n.allow(e) {
+		slog.Debug("notification rate limited", logging.KeyDest, e.Dest, "kind", e.Kind)
+		return
+	}
+	select {
+	case n.queue <- e:
+	default:
+		slog.Warn("notification queue full; dropping event", logging.KeyDest, e.Dest, "kind", e.Kind)
+	}
+}
+
+// allow applies the rate limit. n.mu must be held.
+func (n *Notifier) allow(e Event) bool {
+	if e.Kind == KindTest || n.minInterval <= 0 {
+		return true
+	}
+	key := e.Dest + "\x00" + string(e.Kind)
+	if t, ok := n.last[key]; ok && e.Time.Sub(t) < n.minInterval {
+		return false
+	}
+	n.last[key] = e.Time
+	return true
+}
+
+func (n *Notifier) loop() {
+	defer close(n.done)
+	for e := range n.queue {
+		n.deliver(context.Background(), e)
+	}
+}
+
+// deliver sends e to every route that wants it and returns the first error.
+func (n *Notifier) deliver(ctx context.Context, e Event) error {
+	var first error
+	for _, r := range n.routes {
+		if !r.wants(e.Kind) {
+			continue
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := r.Sink.Send(sendCtx, e)
+		cancel()
+		if err != nil {
+			slog.Warn("send notification failed", "sink", r.Sink.Name(), logging.KeyDest, e.Dest, "kind", e.Kind, logging.Err(err))
+			if first == nil {
+				first = fmt.Errorf("%s: %w", r.Sink.Name(), err)
+			}
+		}
+	}
+	return first
+}
+
+// SendNow delivers e synchronously, bypassing the queue and rate limit, and
+// reports the first sink error.
+func (n *Notifier) SendNow(ctx context.Context, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = n.now()
+	}
+	return n.deliver(ctx, e)
+}
+
+// Close stops accepting events and waits until queued ones are sent or ctx
+// is done.
+func (n *Notifier) Close(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,206 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/notify/notifytest"
+	"rdmirrorsync/internal/status"
+	"rdmirrorsync/internal/syncer"
+)
+
+var testEvent = Event{
+	Kind:     KindFailing,
+	Severity: SeverityError,
+	Dest:     "loc1",
+	Title:    "rd-mirror-sync: loc1 failing",
+	Message:  "3 consecutive runs failed",
+	Time:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestSinkPayloads(t *testing.T) {
+	rcv := notifytest.NewReceiver()
+	defer rcv.Close()
+
+	cases := []struct {
+		cfg   SinkConfig
+		check func(t *testing.T, r notifytest.Request)
+	}{
+		{SinkConfig{Type: TypeWebhook, URL: rcv.URL + "/hook", Token: "s3cret"}, func(t *testing.T, r notifytest.Request) {
+			var e Event
+			if err := json.Unmarshal(r.Body, &e); err != nil || e.Dest != "loc1" || e.Kind != KindFailing {
+				t.Errorf("webhook body %s: %v", r.Body, err)
+			}
+			if r.Header.Get("Authorization") != "Bearer s3cret" {
+				t.Errorf("webhook auth header: %q", r.Header.Get("Authorization"))
+			}
+		}},
+		{SinkConfig{Type: TypeDiscord, URL: rcv.URL + "/discord"}, func(t *testing.T, r notifytest.Request) {
+			var body map[string]string
+			_ = json.Unmarshal(r.Body, &body)
+			if !strings.HasPrefix(body["content"], "**rd-mirror-sync: loc1 failing**\n") {
+				t.Errorf("discord body: %s", r.Body)
+			}
+		}},
+		{SinkConfig{Type: TypeSlack, URL: rcv.URL + "/slack"}, func(t *testing.T, r notifytest.Request) {
+			var body map[string]string
+			_ = json.Unmarshal(r.Body, &body)
+			if !strings.Contains(body["text"], "3 consecutive runs failed") {
+				t.Errorf("slack body: %s", r.Body)
+			}
+		}},
+		{SinkConfig{Type: TypeNtfy, URL: rcv.URL + "/rd-alerts"}, func(t *testing.T, r notifytest.Request) {
+			if string(r.Body) != testEvent.Message || r.Header.Get("Title") != testEvent.Title || r.Header.Get("Priority") != "high" {
+				t.Errorf("ntfy request: headers=%v body=%s", r.Header, r.Body)
+			}
+		}},
+		{SinkConfig{Type: TypeApprise, URL: rcv.URL + "/notify", Targets: "tgram://x/y"}, func(t *testing.T, r notifytest.Request) {
+			var body map[string]string
+			_ = json.Unmarshal(r.Body, &body)
+			if body["type"] != "failure" || body["urls"] != "tgram://x/y" || body["title"] != testEvent.Title {
+				t.Errorf("apprise body: %s", r.Body)
+			}
+		}},
+		{SinkConfig{Type: TypeTelegram, URL: rcv.URL, Token: "123:abc", ChatID: "-100"}, func(t *testing.T, r notifytest.Request) {
+			var body map[string]any
+			_ = json.Unmarshal(r.Body, &body)
+			if r.Path != "/bot123:abc/sendMessage" || body["chat_id"] != "-100" {
+				t.Errorf("telegram request: path=%s body=%s", r.Path, r.Body)
+			}
+		}},
+	}
+	for i, c := range cases {
+		sink, err := NewSink(c.cfg, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", c.cfg.Type, err)
+		}
+		if err := sink.Send(context.Background(), testEvent); err != nil {
+			t.Fatalf("%s: send: %v", c.cfg.Type, err)
+		}
+		reqs := rcv.Requests()
+		if len(reqs) != i+1 || reqs[i].Method != http.MethodPost {
+			t.Fatalf("%s: got %d requests", c.cfg.Type, len(reqs))
+		}
+		t.Run(c.cfg.Type, func(t *testing.T) { c.check(t, reqs[i]) })
+	}
+}
+
+func TestSinkErrorsHideURL(t *testing.T) {
+	rcv := notifytest.NewReceiver()
+	defer rcv.Close()
+	rcv.SetStatus(http.StatusForbidden)
+	sink, _ := NewSink(SinkConfig{Type: TypeTelegram, URL: rcv.URL, Token: "999:secret", ChatID: "1"}, nil)
+	err := sink.Send(context.Background(), testEvent)
+	if err == nil || !strings.Contains(err.Error(), "status=403") {
+		t.Fatalf("want status error, got %v", err)
+	}
+
+	rcv.Close()
+	err = sink.Send(context.Background(), testEvent)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("error leaks the token: %v", err)
+	}
+}
+
+func TestNewSinkValidation(t *testing.T) {
+	bad := []SinkConfig{
+		{Type: "pager"},
+		{Type: TypeDiscord},
+		{Type: TypeSlack, URL: "ftp://example.com"},
+		{Type: TypeTelegram, Token: "x"},
+	}
+	for _, c := range bad {
+		if _, err := NewSink(c, nil); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+}
+
+type recordingSink struct{ events chan Event }
+
+func (s recordingSink) Name() string { return "rec" }
+func (s recordingSink) Send(_ context.Context, e Event) error {
+	s.events <- e
+	return nil
+}
+
+func TestRateLimitAndRouting(t *testing.T) {
+	all := recordingSink{make(chan Event, 10)}
+	failuresOnly := recordingSink{make(chan Event, 10)}
+	n := New([]Route{{Sink: all, Kinds: Kinds}, {Sink: failuresOnly, Kinds: []Kind{KindFailing}}}, time.Hour)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+
+	n.Notify(Event{Kind: KindFailing, Dest: "a"})
+	n.Notify(Event{Kind: KindFailing, Dest: "a"}) // limited
+	n.Notify(Event{Kind: KindFailing, Dest: "b"}) // other destination
+	n.Notify(Event{Kind: KindSummary, Dest: "a"}) // other kind
+	now = now.Add(2 * time.Hour)
+	n.Notify(Event{Kind: KindFailing, Dest: "a"}) // window passed
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(Event{Kind: KindTest}) // after Close: dropped, no panic
+
+	if len(all.events) != 4 {
+		t.Fatalf("all: got %d events, want 4", len(all.events))
+	}
+	if len(failuresOnly.events) != 3 {
+		t.Fatalf("failures-only: got %d events, want 3", len(failuresOnly.events))
+	}
+}
+
+func TestWatcherTransitions(t *testing.T) {
+	sink := recordingSink{make(chan Event, 20)}
+	n := New([]Route{{Sink: sink, Kinds: Kinds}}, 0)
+	w := n.Watch("loc1", WatchOptions{FailAfter: 2, Summary: SummaryChanges})
+	boom := errors.New("list torrents: status=503")
+
+	const ok, degraded, failing = status.HealthOK, status.HealthDegraded, status.HealthFailing
+
+	w.RunFinished(syncer.Stats{}, boom, degraded, "1 consecutive failed runs")
+	w.RunFinished(syncer.Stats{}, boom, failing, "2 consecutive failed runs")
+	w.RunFinished(syncer.Stats{}, boom, failing, "3 consecutive failed runs") // no repeat
+	w.RunFinished(syncer.Stats{}, nil, ok, "")                                // recovered, no changes
+	w.RunFinished(syncer.Stats{AddErrors: 1}, nil, degraded, "1 of 1 adds and deletes failed in the last run")
+	w.RunFinished(syncer.Stats{AddErrors: 2}, nil, degraded, "2 of 2 adds and deletes failed in the last run") // item errors + summary
+	w.RunFinished(syncer.Stats{AwaitingApproval: 40}, nil, ok, "")
+	w.RunFinished(syncer.Stats{AwaitingApproval: 40}, nil, ok, "") // same plan, no repeat
+	w.RunFinished(syncer.Stats{Added: 3, NeedAdd: 3}, nil, ok, "")
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(sink.events)
+
+	var kinds []Kind
+	for e := range sink.events {
+		if e.Dest != "loc1" || e.Time.IsZero() {
+			t.Errorf("bad event %+v", e)
+		}
+		kinds = append(kinds, e.Kind)
+	}
+	want := []Kind{KindDegraded, KindFailing, KindRecovered, KindDegraded, KindSummary, KindItemErrors, KindSummary,
+		KindRecovered, KindDeleteGuard, KindSummary}
+	if len(kinds) != len(want) {
+		t.Fatalf("got %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("got %v, want %v", kinds, want)
+		}
+	}
+}
+
+func TestNilNotifierIsNoop(t *testing.T) {
+	var n *Notifier
+	n.Notify(testEvent)
+	n.Watch("x", WatchOptions{}).RunFinished(syncer.Stats{}, errors.New("x"), status.HealthFailing, "")
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
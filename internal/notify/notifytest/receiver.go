@@ -0,0 +1,79 @@
+// Package notifytest provides a webhook receiver that stands in for Discord,
+// Slack, ntfy and friends in tests and local trials.
+package notifytest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Request is one captured notification.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Receiver records every request it gets and answers with Status.
+type Receiver struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	reqs   []Request
+	status int
+	notify chan struct{}
+}
+
+// NewReceiver starts a Receiver answering 200. Close it when done.
+func NewReceiver() *Receiver {
+	r := &Receiver{status: http.StatusOK, notify: make(chan struct{}, 1)}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.handle))
+	return r
+}
+
+func (r *Receiver) handle(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.reqs = append(r.reqs, Request{Method: req.Method, Path: req.URL.Path, Header: req.Header.Clone(), Body: body})
+	status := r.status
+	r.mu.Unlock()
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(status)
+}
+
+// SetStatus changes the status code returned from now on.
+func (r *Receiver) SetStatus(code int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = code
+}
+
+// Requests returns the requests received so far.
+func (r *Receiver) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Request(nil), r.reqs...)
+}
+
+// WaitFor waits until at least n requests arrived or timeout passes, and
+// returns what was received.
+func (r *Receiver) WaitFor(n int, timeout time.Duration) []Request {
+	deadline := time.After(timeout)
+	for {
+		if reqs := r.Requests(); len(reqs) >= n {
+			return reqs
+		}
+		select {
+		case <-r.notify:
+		case <-deadline:
+			return r.Requests()
+		}
+	}
+}
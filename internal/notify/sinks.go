@@ -0,0 +1,252 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Sink types accepted in SinkConfig.Type.
+const (
+	TypeWebhook  = "webhook"
+	TypeDiscord  = "discord"
+	TypeSlack    = "slack"
+	TypeNtfy     = "ntfy"
+	TypeApprise  = "apprise"
+	TypeTelegram = "telegram"
+)
+
+const defaultTelegramURL = "https://api.telegram.org"
+
+// SinkConfig describes one configured sink.
+type SinkConfig struct {
+	Type string
+	Name string
+	// URL is the webhook URL (webhook, discord, slack), topic URL (ntfy),
+	// Apprise API notify endpoint (apprise) or API base (telegram, optional).
+	URL string
+	// Token is sent as a bearer token (webhook, ntfy) or is the bot token
+	// (telegram).
+	Token string
+	// ChatID is the Telegram chat to post to.
+	ChatID string
+	// Targets are Apprise notification URLs, for the stateless /notify
+	// endpoint; leave empty when URL points at a stored configuration key.
+	Targets string
+	// Kinds limits the events sent; empty means DefaultKinds.
+	Kinds []Kind
+}
+
+// NewSink builds the sink described by c.
+func NewSink(c SinkConfig, client *http.Client) (Sink, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	name := c.Name
+	if name == "" {
+		name = c.Type
+	}
+	h := httpSink{name: name, url: c.URL, token: c.Token, client: client}
+
+	switch c.Type {
+	case TypeWebhook, TypeDiscord, TypeSlack, TypeNtfy, TypeApprise:
+		if err := checkURL(c.URL); err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", name, err)
+		}
+	case TypeTelegram:
+		if c.Token == "" || c.ChatID == "" {
+			return nil, fmt.Errorf("notifier %q: telegram needs token and chat_id", name)
+		}
+		if h.url == "" {
+			h.url = defaultTelegramURL
+		}
+		if err := checkURL(h.url); err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", name, err)
+		}
+	default:
+		return nil, fmt.Errorf("notifier %q: unknown type %q (expected webhook, discord, slack, ntfy, apprise or telegram)", name, c.Type)
+	}
+
+	switch c.Type {
+	case TypeWebhook:
+		return webhookSink{h}, nil
+	case TypeDiscord:
+		return discordSink{h}, nil
+	case TypeSlack:
+		return slackSink{h}, nil
+	case TypeNtfy:
+		return ntfySink{h}, nil
+	case TypeApprise:
+		return appriseSink{httpSink: h, targets: c.Targets}, nil
+	default:
+		return telegramSink{httpSink: h, chatID: c.ChatID}, nil
+	}
+}
+
+func checkURL(s string) error {
+	if s == "" {
+		return errors.New("url is required")
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	return nil
+}
+
+// httpSink holds what every HTTP-based sink needs.
+type httpSink struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (h httpSink) Name() string { return h.name }
+
+// post sends body to u and fails on a non-2xx status. Errors never include
+// the URL, since webhook URLs and bot tokens are secrets.
+func (h httpSink) post(ctx context.Context, u, contentType string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid request")
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status=%d %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (h httpSink) postJSON(ctx context.Context, u string, v any, header http.Header) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return h.post(ctx, u, "application/json", body, header)
+}
+
+func (h httpSink) bearer() http.Header {
+	if h.token == "" {
+		return nil
+	}
+	return http.Header{"Authorization": {"Bearer " + h.token}}
+}
+
+// webhookSink posts the Event as JSON.
+type webhookSink struct{ httpSink }
+
+func (s webhookSink) Send(ctx context.Context, e Event) error {
+	return s.postJSON(ctx, s.url, e, s.bearer())
+}
+
+type discordSink struct{ httpSink }
+
+func (s discordSink) Send(ctx context.Context, e Event) error {
+	return s.postJSON(ctx, s.url, map[string]any{
+		"content": truncate("**"+e.Title+"**\n"+e.Message, 2000),
+	}, nil)
+}
+
+type slackSink struct{ httpSink }
+
+func (s slackSink) Send(ctx context.Context, e Event) error {
+	return s.postJSON(ctx, s.url, map[string]any{
+		"text": "*" + e.Title + "*\n" + e.Message,
+	}, nil)
+}
+
+// ntfySink publishes to an ntfy topic URL, e.g. https://ntfy.sh/my-topic.
+type ntfySink struct{ httpSink }
+
+func (s ntfySink) Send(ctx context.Context, e Event) error {
+	h := s.bearer()
+	if h == nil {
+		h = http.Header{}
+	}
+	h.Set("Title", e.Title)
+	switch e.Severity {
+	case SeverityError:
+		h.Set("Priority", "high")
+		h.Set("Tags", "rotating_light")
+	case SeverityWarning:
+		h.Set("Priority", "default")
+		h.Set("Tags", "warning")
+	default:
+		h.Set("Priority", "low")
+		if e.Kind == KindRecovered {
+			h.Set("Tags", "white_check_mark")
+		}
+	}
+	return s.post(ctx, s.url, "text/plain; charset=utf-8", []byte(e.Message), h)
+}
+
+// appriseSink posts to an Apprise API server, which fans out to any of the
+// services Apprise supports.
+type appriseSink struct {
+	httpSink
+	targets string
+}
+
+func (s appriseSink) Send(ctx context.Context, e Event) error {
+	typ := "info"
+	switch {
+	case e.Severity == SeverityError:
+		typ = "failure"
+	case e.Severity == SeverityWarning:
+		typ = "warning"
+	case e.Kind == KindRecovered:
+		typ = "success"
+	}
+	body := map[string]any{"title": e.Title, "body": e.Message, "type": typ}
+	if s.targets != "" {
+		body["urls"] = s.targets
+	}
+	return s.postJSON(ctx, s.url, body, s.bearer())
+}
+
+type telegramSink struct {
+	httpSink
+	chatID string
+}
+
+func (s telegramSink) Send(ctx context.Context, e Event) error {
+	u := strings.TrimRight(s.url, "/") + "/bot" + s.token + "/sendMessage"
+	return s.postJSON(ctx, u, map[string]any{
+		"chat_id":                  s.chatID,
+		"text":                     truncate(e.Title+"\n"+e.Message, 4096),
+		"disable_web_page_preview": true,
+	}, nil)
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n - 3
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"rdmirrorsync/internal/status"
+	"rdmirrorsync/internal/syncer"
+)
+
+// Summary modes for per-run KindSummary events.
+const (
+	SummaryOff     = "off"
+	SummaryChanges = "changes" // only runs that added, deleted or had errors
+	SummaryAlways  = "always"
+)
+
+// WatchOptions tune when a Watcher raises events.
+type WatchOptions struct {
+	// FailAfter is how many consecutive runs with add/delete errors raise
+	// KindItemErrors.
+	FailAfter int
+	Summary   string
+}
+
+// Watcher turns one destination's run results into events. It is used from
+// that destination's worker goroutine only.
+type Watcher struct {
+	n    *Notifier
+	dest string
+	opts WatchOptions
+
+	health        string // level after the last run, as /healthz reports it
+	itemErrorRuns int
+	itemAlerted   bool
+	awaiting      int
+}
+
+// Watch returns a Watcher for dest. On a nil Notifier it returns nil, whose
+// methods do nothing.
+func (n *Notifier) Watch(dest string, opts WatchOptions) *Watcher {
+	if n == nil {
+		return nil
+	}
+	if opts.FailAfter < 1 {
+		opts.FailAfter = 1
+	}
+	return &Watcher{n: n, dest: dest, opts: opts, health: status.HealthOK}
+}
+
+// RunFinished records the outcome of a run and raises any events it causes.
+// health and reason are the destination's health once the run is recorded,
+// so failing, degraded and recovered events follow the level /healthz
+// reports.
+func (w *Watcher) RunFinished(stats syncer.Stats, err error, health, reason string) {
+	if w == nil {
+		return
+	}
+
+	w.healthChanged(health, reason, err)
+	if err != nil {
+		if w.opts.Summary == SummaryAlways {
+			w.emit(KindSummary, SeverityError, "run failed", err.Error(), nil)
+		}
+		return
+	}
+
+	itemErrors := stats.AddErrors + stats.DeleteErrors
+	if itemErrors > 0 {
+		w.itemErrorRuns++
+		if !w.itemAlerted && w.itemErrorRuns >= w.opts.FailAfter {
+			w.itemAlerted = true
+			w.emit(KindItemErrors, SeverityWarning, "add/delete errors",
+				fmt.Sprintf("%d consecutive runs had add or delete errors; the last had %d add and %d delete errors.",
+					w.itemErrorRuns, stats.AddErrors, stats.DeleteErrors), &stats)
+		}
+	} else {
+		w.itemErrorRuns = 0
+		w.itemAlerted = false
+	}
+
+	if stats.AwaitingApproval > 0 && stats.AwaitingApproval != w.awaiting {
+		w.emit(KindDeleteGuard, SeverityWarning, "deletes held for approval",
+			fmt.Sprintf("A mirror-delete run wants to delete %d torrents, which exceeds delete_approval_over. "+
+				"Review it with \"rd-mirror-sync approve\" or GET /approvals.", stats.AwaitingApproval), &stats)
+	}
+	w.awaiting = stats.AwaitingApproval
+
+	changed := stats.Added+stats.Resumed+stats.Deleted+stats.Deduped+itemErrors > 0
+	if w.opts.Summary == SummaryAlways || (w.opts.Summary == SummaryChanges && changed) {
+		sev := SeverityInfo
+		if itemErrors > 0 {
+			sev = SeverityWarning
+		}
+		w.emit(KindSummary, sev, "sync done", summaryText(stats), &stats)
+	}
+}
+
+// healthChanged raises KindFailing or KindDegraded when health got worse and
+// KindRecovered when it is back to ok. A failing destination that improves
+// to degraded raises nothing until it recovers.
+func (w *Watcher) healthChanged(health, reason string, err error) {
+	prev := w.health
+	w.health = health
+	if health == prev {
+		return
+	}
+	msg := "Health is " + health + ": " + reason + "."
+	if err != nil {
+		msg += fmt.Sprintf(" Last error: %v", err)
+	}
+	switch {
+	case health == status.HealthFailing:
+		w.emit(KindFailing, SeverityError, "failing", msg, nil)
+	case health == status.HealthDegraded && prev == status.HealthOK:
+		w.emit(KindDegraded, SeverityWarning, "degraded", msg, nil)
+	case health == status.HealthOK:
+		w.emit(KindRecovered, SeverityInfo, "recovered", "Health is ok again after being "+prev+".", nil)
+	}
+}
+
+func (w *Watcher) emit(k Kind, sev Severity, what, msg string, stats *syncer.Stats) {
+	w.n.Notify(Event{
+		Kind:     k,
+		Severity: sev,
+		Dest:     w.dest,
+		Title:    "rd-mirror-sync: " + w.dest + " " + what,
+		Message:  msg,
+		Stats:    stats,
+	})
+}
+
+func summaryText(s syncer.Stats) string {
+	parts := []string{
+		fmt.Sprintf("added %d/%d", s.Added, s.NeedAdd),
+		fmt.Sprintf("deleted %d/%d", s.Deleted, s.NeedDelete),
+	}
+	if s.NeedResume > 0 {
+		parts = append(parts, fmt.Sprintf("resumed %d/%d", s.Resumed, s.NeedResume))
+	}
+	if s.Duplicates > 0 {
+		parts = append(parts, fmt.Sprintf("deduped %d/%d", s.Deduped, s.Duplicates))
+	}
+	if s.AddErrors+s.DeleteErrors > 0 {
+		parts = append(parts, fmt.Sprintf("errors: %d add, %d delete", s.AddErrors, s.DeleteErrors))
+	}
+	if s.AwaitingApproval > 0 {
+		parts = append(parts, fmt.Sprintf("%d deletes awaiting approval", s.AwaitingApproval))
+	}
+	return strings.Join(parts, ", ") + fmt.Sprintf(" (source %d, destination %d)", s.SourceCount, s.DestCount)
+}
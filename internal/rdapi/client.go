@@ -10,9 +10,13 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/tracing"
 )
 
 // isEOF reports whether err is (or wraps) an unexpected end-of-stream from
@@ -30,6 +34,21 @@ type ClientConfig struct {
 	RetryBase      time.Duration
 	RetryMaxJitter time.Duration
 	PageLimit      int
+
+	// Observer, when set, is told about every HTTP attempt and retry.
+	Observer Observer
+	// Tracer, when set, records a span per listing page and per attempt.
+	Tracer *tracing.Tracer
+}
+
+// Observer receives per-request telemetry from the Client. Routes are
+// "METHOD /path" with torrent IDs stripped, e.g. "POST /torrents/selectFiles".
+type Observer interface {
+	// ObserveRequest is called once per HTTP attempt. code is 0 when no
+	// response was received.
+	ObserveRequest(route string, code int, elapsed time.Duration)
+	// ObserveRetry is called before each retry of a failed attempt.
+	ObserveRetry(route string)
 }
 
 type Client struct {
@@ -65,8 +84,63 @@ func NewClient(cfg ClientConfig) *Client {
 	}
 }
 
+// ErrIncompleteListing is returned when a listing still disagrees with RD's
+// X-Total-Count after every attempt, so torrents may have been missed.
+var ErrIncompleteListing = errors.New("incomplete listing")
+
+// listAttempts is how many times a listing whose count disagrees with
+// X-Total-Count is read before ErrIncompleteListing is returned.
+const listAttempts = 3
+
+// ListAllTorrents returns every torrent on the account. Large libraries are
+// better served by ListTorrentPages, which does not hold them all at once.
+// Like ListTorrentPages, it returns the torrents it saw along with
+// ErrIncompleteListing.
 func (c *Client) ListAllTorrents(ctx context.Context, token string) ([]Torrent, error) {
 	var all []Torrent
+	err := c.ListTorrentPages(ctx, token, func() { all = all[:0] }, func(page []Torrent) error {
+		all = append(all, page...)
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrIncompleteListing) {
+		return nil, err
+	}
+	return all, err
+}
+
+// ListTorrentPages calls fn with each page of the account's torrents as it
+// arrives. fn must not keep the slice; an error from fn stops the listing and
+// is returned as is.
+//
+// Torrents added or removed while paging shift entries between pages, so a
+// torrent seen twice is passed to fn once, and a listing whose count
+// disagrees with RD's X-Total-Count is read again, calling reset first so
+// the caller can drop what it collected. If the last attempt still
+// disagrees, its torrents have been passed to fn and ErrIncompleteListing is
+// returned.
+func (c *Client) ListTorrentPages(ctx context.Context, token string, reset func(), fn func(page []Torrent) error) error {
+	var err error
+	for attempt := 1; attempt <= listAttempts; attempt++ {
+		if attempt > 1 {
+			logging.FromContext(ctx).Warn("torrent listing changed while paging, listing again",
+				logging.KeyOp, "GET /torrents", logging.KeyAttempt, attempt, logging.Err(err))
+			reset()
+		}
+		err = c.listOnce(ctx, token, fn)
+		if !errors.Is(err, ErrIncompleteListing) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w after %d attempts", err, listAttempts)
+}
+
+// listOnce reads every page once. It returns ErrIncompleteListing when the
+// number of distinct torrents seen, or X-Total-Count itself, disagrees with
+// the count RD gave on the first page.
+func (c *Client) listOnce(ctx context.Context, token string, fn func(page []Torrent) error) error {
+	seen := make(map[string]struct{})
+	total, dups := -1, 0
+	totalChanged := false
 	for page := 1; ; page++ {
 		u, _ := url.Parse(c.baseURL + "/torrents")
 		q := u.Query()
@@ -75,30 +149,75 @@ func (c *Client) ListAllTorrents(ctx context.Context, token string) ([]Torrent,
 		u.RawQuery = q.Encode()
 
 		var batch []Torrent
-		if err := c.getJSONWithRetry(ctx, token, u.String(), &batch); err != nil {
+		pageTotal := -1
+		pageCtx, span := c.cfg.Tracer.Start(ctx, "rdapi.list_page", tracing.Int("page", page), tracing.Int("limit", c.cfg.PageLimit))
+		err := c.doRequest(pageCtx, token, "GET /torrents", "GET "+u.String(), func(ctx context.Context) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		}, &batch, func(h http.Header) {
+			if n, err := strconv.Atoi(h.Get("X-Total-Count")); err == nil && n >= 0 {
+				pageTotal = n
+			}
+		})
+		span.SetAttributes(tracing.Int("count", len(batch)))
+		if err != nil {
 			// RD drops the connection instead of returning [] when a page
 			// request lands exactly on a page boundary. Treat as end-of-list.
 			if page > 1 && isEOF(err) {
+				logging.FromContext(ctx).Debug("EOF on page boundary; treating as end of list", logging.KeyOp, "GET /torrents", "page", page)
+				span.SetAttributes(tracing.Bool("eof_end_of_list", true))
+				span.End()
 				break
 			}
-			return nil, fmt.Errorf("list torrents page=%d: %w", page, err)
+			span.RecordError(err)
+			span.End()
+			return fmt.Errorf("list torrents page=%d: %w", page, err)
+		}
+		span.End()
+		if pageTotal >= 0 {
+			if total < 0 {
+				total = pageTotal
+			} else if pageTotal != total {
+				totalChanged = true
+			}
 		}
 		if len(batch) == 0 {
 			break
 		}
-		all = append(all, batch...)
-		if len(batch) < c.cfg.PageLimit {
+		full := len(batch) >= c.cfg.PageLimit
+		fresh := batch[:0]
+		for _, t := range batch {
+			if _, ok := seen[t.ID]; ok {
+				dups++
+				continue
+			}
+			seen[t.ID] = struct{}{}
+			fresh = append(fresh, t)
+		}
+		if len(fresh) == 0 {
+			// A page of nothing but repeats would otherwise page forever.
+			return fmt.Errorf("%w: page %d repeated earlier torrents", ErrIncompleteListing, page)
+		}
+		if err := fn(fresh); err != nil {
+			return err
+		}
+		if !full {
 			break
 		}
 	}
-	return all, nil
+	if dups > 0 {
+		logging.FromContext(ctx).Debug("dropped torrents repeated across pages", logging.KeyOp, "GET /torrents", "duplicates", dups)
+	}
+	if total >= 0 && (totalChanged || len(seen) != total) {
+		return fmt.Errorf("%w: saw %d of %d torrents", ErrIncompleteListing, len(seen), total)
+	}
+	return nil
 }
 
 func (c *Client) AddMagnetByHash(ctx context.Context, token, hash string) (string, error) {
 	form := url.Values{}
 	form.Set("magnet", "magnet:?xt=urn:btih:"+strings.TrimSpace(hash))
 	var out addMagnetResponse
-	if err := c.postFormJSONWithRetry(ctx, token, c.baseURL+"/torrents/addMagnet", form, &out); err != nil {
+	if err := c.postFormJSONWithRetry(ctx, token, "/torrents/addMagnet", c.baseURL+"/torrents/addMagnet", form, &out); err != nil {
 		return "", err
 	}
 	if out.ID == "" {
@@ -110,34 +229,62 @@ func (c *Client) AddMagnetByHash(ctx context.Context, token, hash string) (strin
 func (c *Client) SelectFilesAll(ctx context.Context, token, torrentID string) error {
 	form := url.Values{}
 	form.Set("files", "all")
-	return c.postFormNoBodyWithRetry(ctx, token, c.baseURL+"/torrents/selectFiles/"+url.PathEscape(torrentID), form)
+	return c.postFormNoBodyWithRetry(ctx, token, "/torrents/selectFiles", c.baseURL+"/torrents/selectFiles/"+url.PathEscape(torrentID), form)
 }
 
 func (c *Client) DeleteTorrent(ctx context.Context, token, torrentID string) error {
-	return c.deleteWithRetry(ctx, token, c.baseURL+"/torrents/delete/"+url.PathEscape(torrentID))
+	return c.deleteWithRetry(ctx, token, "/torrents/delete", c.baseURL+"/torrents/delete/"+url.PathEscape(torrentID))
+}
+
+// User returns the account token belongs to, which makes it a cheap check
+// that the token is valid.
+func (c *Client) User(ctx context.Context, token string) (User, error) {
+	var u User
+	if err := c.getJSONWithRetry(ctx, token, "/user", c.baseURL+"/user", &u); err != nil {
+		return User{}, err
+	}
+	return u, nil
 }
 
 // doRequest performs an HTTP request with retries via withRetry.
 // On each attempt it builds the request via mkReq, sets Authorization, executes it, checks status, then decodes or discards the body.
 // If out is non-nil, the response JSON is decoded into out; if out is nil, the body is discarded (read to EOF so the connection can be reused).
-func (c *Client) doRequest(ctx context.Context, token, op string, mkReq func() (*http.Request, error), out any) error {
-	return c.withRetry(ctx, op, func() error {
-		req, err := mkReq()
+// If header is non-nil, it is called with the headers of a successful response.
+// route labels the request for the Observer; op is used in error messages.
+func (c *Client) doRequest(ctx context.Context, token, route, op string, mkReq func(ctx context.Context) (*http.Request, error), out any, header func(http.Header)) error {
+	return c.withRetry(ctx, op, route, func(ctx context.Context) error {
+		req, err := mkReq(ctx)
 		if err != nil {
 			return err
 		}
 		req.Header.Set("Authorization", "Bearer "+token)
+
+		code := 0
+		start := time.Now()
+		defer func() {
+			if code != 0 {
+				tracing.SpanFromContext(ctx).SetAttributes(tracing.Int("http.status_code", code))
+			}
+			if c.cfg.Observer != nil {
+				c.cfg.Observer.ObserveRequest(route, code, time.Since(start))
+			}
+		}()
+
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
 			return retryable(err)
 		}
 		defer resp.Body.Close()
+		code = resp.StatusCode
 		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
 			return retryable(fmt.Errorf("status=%d", resp.StatusCode))
 		}
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 			return fmt.Errorf("status=%d", resp.StatusCode)
 		}
+		if header != nil {
+			header(resp.Header)
+		}
 		if out != nil {
 			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
 				return retryable(err)
@@ -151,57 +298,63 @@ func (c *Client) doRequest(ctx context.Context, token, op string, mkReq func() (
 	})
 }
 
-func (c *Client) getJSONWithRetry(ctx context.Context, token, endpoint string, out any) error {
-	return c.doRequest(ctx, token, "GET "+endpoint, func() (*http.Request, error) {
+func (c *Client) getJSONWithRetry(ctx context.Context, token, route, endpoint string, out any) error {
+	return c.doRequest(ctx, token, "GET "+route, "GET "+endpoint, func(ctx context.Context) (*http.Request, error) {
 		return http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	}, out)
+	}, out, nil)
 }
 
-func (c *Client) postFormJSONWithRetry(ctx context.Context, token, endpoint string, form url.Values, out any) error {
+func (c *Client) postFormJSONWithRetry(ctx context.Context, token, route, endpoint string, form url.Values, out any) error {
 	encodedForm := form.Encode()
-	return c.doRequest(ctx, token, "POST "+endpoint, func() (*http.Request, error) {
+	return c.doRequest(ctx, token, "POST "+route, "POST "+endpoint, func(ctx context.Context) (*http.Request, error) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(encodedForm))
 		if err != nil {
 			return nil, err
 		}
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		return req, nil
-	}, out)
+	}, out, nil)
 }
 
-func (c *Client) postFormNoBodyWithRetry(ctx context.Context, token, endpoint string, form url.Values) error {
+func (c *Client) postFormNoBodyWithRetry(ctx context.Context, token, route, endpoint string, form url.Values) error {
 	encodedForm := form.Encode()
-	return c.doRequest(ctx, token, "POST "+endpoint, func() (*http.Request, error) {
+	return c.doRequest(ctx, token, "POST "+route, "POST "+endpoint, func(ctx context.Context) (*http.Request, error) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(encodedForm))
 		if err != nil {
 			return nil, err
 		}
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		return req, nil
-	}, nil)
+	}, nil, nil)
 }
 
-func (c *Client) deleteWithRetry(ctx context.Context, token, endpoint string) error {
-	return c.doRequest(ctx, token, "DELETE "+endpoint, func() (*http.Request, error) {
+func (c *Client) deleteWithRetry(ctx context.Context, token, route, endpoint string) error {
+	return c.doRequest(ctx, token, "DELETE "+route, "DELETE "+endpoint, func(ctx context.Context) (*http.Request, error) {
 		return http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
-	}, nil)
+	}, nil, nil)
 }
 
 type retryErr struct{ err error }
 
-func (e retryErr) Error() string  { return e.err.Error() }
-func (e retryErr) Unwrap() error  { return e.err }
-func retryable(err error) error   { return retryErr{err: err} }
+func (e retryErr) Error() string { return e.err.Error() }
+func (e retryErr) Unwrap() error { return e.err }
+func retryable(err error) error  { return retryErr{err: err} }
 
 func isRetryable(err error) bool {
 	var re retryErr
 	return errors.As(err, &re)
 }
 
-func (c *Client) withRetry(ctx context.Context, op string, fn func() error) error {
+// withRetry runs fn until it succeeds, fails permanently or retries run out.
+// Each attempt gets its own span, named after route, in the ctx passed to fn.
+func (c *Client) withRetry(ctx context.Context, op, route string, fn func(ctx context.Context) error) error {
 	var last error
 	for attempt := 1; attempt <= c.cfg.MaxRetries; attempt++ {
-		err := fn()
+		attemptCtx, span := c.cfg.Tracer.StartKind(ctx, route, tracing.KindClient,
+			tracing.String("http.route", route), tracing.Int("attempt", attempt))
+		err := fn(attemptCtx)
+		span.RecordError(err)
+		span.End()
 		if err == nil {
 			return nil
 		}
@@ -212,6 +365,8 @@ func (c *Client) withRetry(ctx context.Context, op string, fn func() error) erro
 
 		backoff := c.cfg.RetryBase * time.Duration(1<<(attempt-1))
 		wait := backoff + c.randomJitter(c.cfg.RetryMaxJitter)
+		logging.FromContext(ctx).Warn("API request failed, retrying",
+			logging.KeyOp, route, logging.KeyAttempt, attempt, "max_attempts", c.cfg.MaxRetries, "wait", wait, logging.Err(err))
 		timer := time.NewTimer(wait)
 		select {
 		case <-ctx.Done():
@@ -220,6 +375,9 @@ func (c *Client) withRetry(ctx context.Context, op string, fn func() error) erro
 		case <-timer.C:
 		}
 		timer.Stop()
+		if c.cfg.Observer != nil {
+			c.cfg.Observer.ObserveRetry(route)
+		}
 	}
 	return fmt.Errorf("%s failed after retries: %w", op, last)
 }
@@ -3,10 +3,14 @@ package rdapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"rdmirrorsync/internal/tracing"
 )
 
 // TestListAllTorrentsEOFOnPageBoundary simulates Real-Debrid dropping the TCP
@@ -94,3 +98,256 @@ func TestListAllTorrentsPagination(t *testing.T) {
 		t.Fatalf("expected 3 torrents, got %d", len(all))
 	}
 }
+
+func TestListTorrentPagesStopsOnCallbackError(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		requested = append(requested, page)
+		_ = json.NewEncoder(w).Encode([]Torrent{{ID: page + "a"}, {ID: page + "b"}})
+	}))
+	defer srv.Close()
+
+	client := NewClient(ClientConfig{
+		BaseURL:     srv.URL,
+		HTTPTimeout: 2 * time.Second,
+		MaxRetries:  2,
+		RetryBase:   1 * time.Millisecond,
+		PageLimit:   2,
+	})
+
+	stop := errors.New("stop")
+	pages := 0
+	err := client.ListTorrentPages(context.Background(), "token", func() {}, func(page []Torrent) error {
+		pages++
+		if len(page) != 2 {
+			t.Fatalf("page %d has %d torrents, want 2", pages, len(page))
+		}
+		if pages == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("err = %v, want the callback's error", err)
+	}
+	if len(requested) != 2 {
+		t.Fatalf("requested pages %v, want only 1 and 2", requested)
+	}
+}
+
+// TestListTorrentPagesDedupesShiftedEntries simulates a torrent added while
+// paging: the last entry of page 1 shifts onto page 2 and is seen twice.
+func TestListTorrentPagesDedupesShiftedEntries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "3")
+		switch r.URL.Query().Get("page") {
+		case "1":
+			_ = json.NewEncoder(w).Encode([]Torrent{{ID: "1", Hash: "aaa"}, {ID: "2", Hash: "bbb"}})
+		case "2":
+			_ = json.NewEncoder(w).Encode([]Torrent{{ID: "2", Hash: "bbb"}, {ID: "3", Hash: "ccc"}})
+		default:
+			_ = json.NewEncoder(w).Encode([]Torrent{})
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClient(ClientConfig{BaseURL: srv.URL, HTTPTimeout: 2 * time.Second, MaxRetries: 2, RetryBase: time.Millisecond, PageLimit: 2})
+	all, err := client.ListAllTorrents(context.Background(), "token")
+	if err != nil {
+		t.Fatalf("ListAllTorrents failed: %v", err)
+	}
+	var ids []string
+	for _, tr := range all {
+		ids = append(ids, tr.ID)
+	}
+	if fmt.Sprint(ids) != "[1 2 3]" {
+		t.Fatalf("ids = %v, want [1 2 3]", ids)
+	}
+}
+
+// TestListTorrentPagesRelistsOnCountMismatch simulates a torrent removed
+// while paging: the first listing misses one, the second is consistent.
+func TestListTorrentPagesRelistsOnCountMismatch(t *testing.T) {
+	listings := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "1" {
+			listings++
+		}
+		w.Header().Set("X-Total-Count", "3")
+		switch {
+		case page == "1":
+			_ = json.NewEncoder(w).Encode([]Torrent{{ID: "1"}, {ID: "2"}})
+		case page == "2" && listings == 1:
+			_ = json.NewEncoder(w).Encode([]Torrent{})
+		case page == "2":
+			_ = json.NewEncoder(w).Encode([]Torrent{{ID: "3"}})
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClient(ClientConfig{BaseURL: srv.URL, HTTPTimeout: 2 * time.Second, MaxRetries: 2, RetryBase: time.Millisecond, PageLimit: 2})
+	resets, got := 0, 0
+	err := client.ListTorrentPages(context.Background(), "token", func() {
+		resets++
+		got = 0
+	}, func(page []Torrent) error {
+		got += len(page)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ListTorrentPages failed: %v", err)
+	}
+	if listings != 2 || resets != 1 || got != 3 {
+		t.Fatalf("listings=%d resets=%d got=%d, want 2, 1 and 3", listings, resets, got)
+	}
+}
+
+func TestListTorrentPagesReportsIncompleteListing(t *testing.T) {
+	listings := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" {
+			listings++
+		}
+		// One torrent is always missing from the listing.
+		w.Header().Set("X-Total-Count", "2")
+		_ = json.NewEncoder(w).Encode([]Torrent{{ID: "1"}})
+	}))
+	defer srv.Close()
+
+	client := NewClient(ClientConfig{BaseURL: srv.URL, HTTPTimeout: 2 * time.Second, MaxRetries: 2, RetryBase: time.Millisecond, PageLimit: 2})
+	all, err := client.ListAllTorrents(context.Background(), "token")
+	if !errors.Is(err, ErrIncompleteListing) {
+		t.Fatalf("err = %v, want ErrIncompleteListing", err)
+	}
+	if listings != listAttempts {
+		t.Fatalf("listed %d times, want %d", listings, listAttempts)
+	}
+	if len(all) != 1 {
+		t.Fatalf("got %d torrents, want the last listing's 1", len(all))
+	}
+}
+
+type recordingObserver struct {
+	requests []string
+	retries  []string
+}
+
+func (o *recordingObserver) ObserveRequest(route string, code int, _ time.Duration) {
+	o.requests = append(o.requests, fmt.Sprintf("%s %d", route, code))
+}
+
+func (o *recordingObserver) ObserveRetry(route string) {
+	o.retries = append(o.retries, route)
+}
+
+func TestObserverSeesAttemptsAndRetries(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	obs := &recordingObserver{}
+	client := NewClient(ClientConfig{
+		BaseURL:     srv.URL,
+		HTTPTimeout: 2 * time.Second,
+		MaxRetries:  3,
+		RetryBase:   1 * time.Millisecond,
+		PageLimit:   2,
+		Observer:    obs,
+	})
+
+	if err := client.DeleteTorrent(context.Background(), "token", "ABC123"); err != nil {
+		t.Fatalf("DeleteTorrent failed: %v", err)
+	}
+	want := []string{"DELETE /torrents/delete 503", "DELETE /torrents/delete 204"}
+	if fmt.Sprint(obs.requests) != fmt.Sprint(want) {
+		t.Fatalf("requests: got %v, want %v", obs.requests, want)
+	}
+	if len(obs.retries) != 1 || obs.retries[0] != "DELETE /torrents/delete" {
+		t.Fatalf("retries: got %v", obs.retries)
+	}
+}
+
+func TestTracerRecordsPagesAndAttempts(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]Torrent{{ID: "1", Hash: "a"}})
+	}))
+	defer srv.Close()
+
+	exp := &tracing.MemoryExporter{}
+	tr := tracing.NewTracer(exp)
+	client := NewClient(ClientConfig{
+		BaseURL:     srv.URL,
+		HTTPTimeout: 2 * time.Second,
+		MaxRetries:  3,
+		RetryBase:   1 * time.Millisecond,
+		PageLimit:   2,
+		Tracer:      tr,
+	})
+	if _, err := client.ListAllTorrents(context.Background(), "token"); err != nil {
+		t.Fatalf("ListAllTorrents failed: %v", err)
+	}
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 2 attempts and 1 page", len(spans))
+	}
+	a1, a2, page := spans[0], spans[1], spans[2]
+	if page.Name != "rdapi.list_page" || page.Attr("page") != int64(1) || page.Attr("count") != int64(1) {
+		t.Fatalf("page span: %+v", page)
+	}
+	for i, a := range []tracing.SpanData{a1, a2} {
+		if a.Name != "GET /torrents" || a.ParentID != page.SpanID || a.Attr("attempt") != int64(i+1) {
+			t.Fatalf("attempt %d span: %+v", i+1, a)
+		}
+	}
+	if a1.Err == "" || a1.Attr("http.status_code") != int64(502) || a2.Err != "" {
+		t.Fatalf("attempt status: first=%+v second=%+v", a1, a2)
+	}
+}
+
+func TestUserRejectsBadTokenWithoutRetry(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/user" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(User{ID: 7, Username: "me", Type: "premium"})
+	}))
+	defer srv.Close()
+
+	client := NewClient(ClientConfig{BaseURL: srv.URL, HTTPTimeout: 2 * time.Second, MaxRetries: 3, PageLimit: 1})
+	u, err := client.User(context.Background(), "good")
+	if err != nil || u.Username != "me" {
+		t.Fatalf("good token: %+v, %v", u, err)
+	}
+	calls = 0
+	if _, err := client.User(context.Background(), "bad"); err == nil {
+		t.Fatal("expected an error for a bad token")
+	}
+	if calls != 1 {
+		t.Fatalf("401 should not be retried, got %d calls", calls)
+	}
+}
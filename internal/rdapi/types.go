@@ -5,9 +5,30 @@ type Torrent struct {
 	Hash     string `json:"hash"`
 	Filename string `json:"filename"`
 	Status   string `json:"status"`
+	// Added is when the torrent was added, as an ISO 8601 UTC timestamp, so
+	// it sorts as a string.
+	Added string `json:"added"`
 }
 
+// StatusDownloaded is the status of a torrent whose files are ready.
+const StatusDownloaded = "downloaded"
+
+// Torrent statuses before files are selected. Real-Debrid downloads nothing
+// until a selection is made, so a torrent left in either is stuck.
+const (
+	StatusMagnetConversion = "magnet_conversion"
+	StatusWaitingFiles     = "waiting_files_selection"
+)
+
 type addMagnetResponse struct {
 	ID  string `json:"id"`
 	URI string `json:"uri"`
 }
+
+// User is the account a token belongs to, as returned by GET /user.
+type User struct {
+	ID         int    `json:"id"`
+	Username   string `json:"username"`
+	Type       string `json:"type"`
+	Expiration string `json:"expiration"`
+}
@@ -0,0 +1,177 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week. Fields accept *, lists, ranges and steps, e.g.
+// "*/15 6-23 * * mon-fri". As in Vixie cron, when both day fields are
+// restricted a day matching either one runs.
+type Cron struct {
+	expr                         string
+	minute, hour, dom, month, dw uint64 // bit i set = value i allowed
+	domStar, dowStar             bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dowNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// ParseCron parses a five-field cron expression or one of @hourly, @daily,
+// @midnight, @weekly and @monthly. Times are in the local time zone.
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	spec := expr
+	if m, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	c := &Cron{expr: expr}
+	var err error
+	parse := func(i, min, max int, names map[string]int) uint64 {
+		if err != nil {
+			return 0
+		}
+		var bits uint64
+		bits, err = parseCronField(fields[i], min, max, names)
+		if err != nil {
+			err = fmt.Errorf("cron %q: field %d: %w", expr, i+1, err)
+		}
+		return bits
+	}
+	c.minute = parse(0, 0, 59, nil)
+	c.hour = parse(1, 0, 23, nil)
+	c.dom = parse(2, 1, 31, nil)
+	c.month = parse(3, 1, 12, monthNames)
+	c.dw = parse(4, 0, 7, dowNames)
+	if err != nil {
+		return nil, err
+	}
+	// 7 is Sunday too.
+	if c.dw&(1<<7) != 0 {
+		c.dw = c.dw&^(1<<7) | 1
+	}
+	// As in Vixie cron, a field starting with '*' (including "*/n") counts
+	// as unrestricted when deciding whether day of month and day of week
+	// must both match.
+	c.domStar = strings.HasPrefix(fields[2], "*") || fields[2] == "?"
+	c.dowStar = strings.HasPrefix(fields[4], "*") || fields[4] == "?"
+	return c, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = cronValue(a, names); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(b, names); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := cronValue(rng, names)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+func (c *Cron) String() string { return "cron " + c.expr }
+
+// Next returns the first matching minute strictly after t, or the zero time
+// if none occurs within five years (e.g. "0 0 30 2 *").
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dw&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
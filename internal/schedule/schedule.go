@@ -0,0 +1,165 @@
+// Package schedule decides when a destination runs: on a fixed interval or a
+// cron expression, with optional daily quiet windows during which runs must
+// not write.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule yields the run times of a destination.
+type Schedule interface {
+	// Next returns the first run time strictly after t.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// Every returns a Schedule firing every d.
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+func (e every) String() string             { return "every " + time.Duration(e).String() }
+
+// MaxGap returns the longest time between consecutive runs of s in the week
+// after from. For an interval that is the interval; for cron expressions it
+// covers quiet nights and weekends, so health checks know how long a
+// destination may go without running.
+func MaxGap(s Schedule, from time.Time) time.Duration {
+	if e, ok := s.(every); ok {
+		return time.Duration(e)
+	}
+	end := from.Add(7 * 24 * time.Hour)
+	prev := s.Next(from)
+	var gap time.Duration
+	for !prev.IsZero() && prev.Before(end) {
+		next := s.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if d := next.Sub(prev); d > gap {
+			gap = d
+		}
+		prev = next
+	}
+	return gap
+}
+
+// MinGap returns the shortest time between consecutive runs of s in the
+// week after from, or 0 when s fires at most once in that week.
+func MinGap(s Schedule, from time.Time) time.Duration {
+	if e, ok := s.(every); ok {
+		return time.Duration(e)
+	}
+	end := from.Add(7 * 24 * time.Hour)
+	prev := s.Next(from)
+	var gap time.Duration
+	for !prev.IsZero() && prev.Before(end) {
+		next := s.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if d := next.Sub(prev); gap == 0 || d < gap {
+			gap = d
+		}
+		prev = next
+	}
+	return gap
+}
+
+// Window is a daily span of wall-clock time, e.g. 18:00-23:00. A window whose
+// end is before its start wraps past midnight.
+type Window struct {
+	Start, End int // minutes since midnight
+}
+
+// ParseWindow parses "HH:MM-HH:MM".
+func ParseWindow(s string) (Window, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return Window{}, fmt.Errorf("quiet window %q: expected HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return Window{}, fmt.Errorf("quiet window %q: %w", s, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return Window{}, fmt.Errorf("quiet window %q: %w", s, err)
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("quiet window %q: start and end are equal", s)
+	}
+	return Window{Start: start, End: end}, nil
+}
+
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	hh, err := strconv.Atoi(h)
+	if err != nil || hh < 0 || hh > 24 {
+		return 0, fmt.Errorf("invalid hour in %q", s)
+	}
+	mm, err := strconv.Atoi(m)
+	if err != nil || mm < 0 || mm > 59 || (hh == 24 && mm != 0) {
+		return 0, fmt.Errorf("invalid minute in %q", s)
+	}
+	return hh*60 + mm, nil
+}
+
+// Contains reports whether t's local wall-clock time falls in the window.
+// The start is inclusive, the end exclusive.
+func (w Window) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.Start < w.End {
+		return m >= w.Start && m < w.End
+	}
+	return m >= w.Start || m < w.End
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
+
+// Windows is a set of quiet windows.
+type Windows []Window
+
+// ParseWindows parses each entry with ParseWindow.
+func ParseWindows(specs []string) (Windows, error) {
+	ws := make(Windows, 0, len(specs))
+	for _, s := range specs {
+		w, err := ParseWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
+
+// Contains reports whether t falls in any of the windows.
+func (ws Windows) Contains(t time.Time) bool {
+	for _, w := range ws {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Strings returns the windows in HH:MM-HH:MM form.
+func (ws Windows) Strings() []string {
+	out := make([]string, len(ws))
+	for i, w := range ws {
+		out[i] = w.String()
+	}
+	return out
+}
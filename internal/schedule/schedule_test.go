@@ -0,0 +1,165 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 7, 30, 0, time.UTC) // a Wednesday
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)},
+		{"30 9-17 * * mon-fri", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"0 8 * * sat,sun", time.Date(2024, 5, 4, 8, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 7", time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)}, // Sunday matches before the 15th
+		{"@hourly", time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 5, 1, 10, 25, 0, 0, time.UTC)},
+		{"0 0 */2 * mon", time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)}, // odd-day Mondays only, as in Vixie cron
+	}
+	for _, tc := range cases {
+		c, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if got := c.Next(base); !got.Equal(tc.want) {
+			t.Errorf("%s: next after %s = %s, want %s", tc.expr, base, got, tc.want)
+		}
+	}
+
+	never, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := never.Next(base); !got.IsZero() {
+		t.Errorf("Feb 30 should never fire, got %s", got)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestMaxGap(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	if got := MaxGap(Every(5*time.Minute), from); got != 5*time.Minute {
+		t.Errorf("interval: got %s", got)
+	}
+	weekdays, _ := ParseCron("0 * * * mon-fri")
+	// Friday 23:00 to Monday 00:00.
+	if got := MaxGap(weekdays, from); got != 49*time.Hour {
+		t.Errorf("weekdays: got %s, want 49h", got)
+	}
+}
+
+func TestMinGap(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	if got := MinGap(Every(5*time.Minute), from); got != 5*time.Minute {
+		t.Errorf("interval: got %s", got)
+	}
+	dense, _ := ParseCron("0,5 * * * *")
+	if got := MinGap(dense, from); got != 5*time.Minute {
+		t.Errorf("dense cron: got %s, want 5m", got)
+	}
+}
+
+func TestWindows(t *testing.T) {
+	ws, err := ParseWindows([]string{"18:00-23:00", "23:30-06:15"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(h, m int) time.Time { return time.Date(2024, 5, 1, h, m, 0, 0, time.UTC) }
+	for _, tc := range []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(17, 59), false},
+		{at(18, 0), true},
+		{at(22, 59), true},
+		{at(23, 0), false},
+		{at(23, 45), true},
+		{at(3, 0), true},
+		{at(6, 15), false},
+	} {
+		if got := ws.Contains(tc.t); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.t.Format("15:04"), got, tc.want)
+		}
+	}
+	if got := ws.Strings(); got[1] != "23:30-06:15" {
+		t.Errorf("String: %v", got)
+	}
+
+	for _, bad := range []string{"18:00", "18-23", "25:00-01:00", "10:00-10:00", "10:60-11:00"} {
+		if _, err := ParseWindow(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestNextAfterSkipsMissedSlots(t *testing.T) {
+	s := Every(time.Minute)
+	prev := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	next, skipped := NextAfter(s, prev, prev.Add(10*time.Second))
+	if !next.Equal(prev.Add(time.Minute)) || skipped != 0 {
+		t.Fatalf("on time: %s, skipped %d", next, skipped)
+	}
+	// The run took 3.5 minutes: the 10:01, 10:02 and 10:03 slots passed.
+	next, skipped = NextAfter(s, prev, prev.Add(210*time.Second))
+	if !next.Equal(prev.Add(4*time.Minute)) || skipped != 3 {
+		t.Fatalf("overrun: %s, skipped %d", next, skipped)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := Every(time.Minute)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	next := now.Add(time.Minute)
+	for _, tc := range []struct {
+		failures int
+		max      time.Duration
+		want     time.Duration // from now
+		skipped  int
+	}{
+		{0, time.Hour, time.Minute, 0},
+		{1, time.Hour, time.Minute, 0},
+		{2, time.Hour, 2 * time.Minute, 1},
+		{4, time.Hour, 8 * time.Minute, 7},
+		{10, 30 * time.Minute, 30 * time.Minute, 29},
+		{100, 30 * time.Minute, 30 * time.Minute, 29},
+		{5, 0, time.Minute, 0},
+	} {
+		got, skipped := Backoff(s, next, tc.failures, tc.max, now)
+		if !got.Equal(now.Add(tc.want)) || skipped != tc.skipped {
+			t.Errorf("failures=%d max=%s: got +%s skipped %d, want +%s skipped %d",
+				tc.failures, tc.max, got.Sub(now), skipped, tc.want, tc.skipped)
+		}
+	}
+
+	// A slot beyond max is never taken, however many failures.
+	nightly, _ := ParseCron("0 3 * * *")
+	n := nightly.Next(now)
+	if got, skipped := Backoff(nightly, n, 5, time.Hour, now); !got.Equal(n) || skipped != 0 {
+		t.Errorf("nightly: got %s skipped %d", got, skipped)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	if Jitter(0) != 0 {
+		t.Fatal("zero max should give zero jitter")
+	}
+	for i := 0; i < 100; i++ {
+		if d := Jitter(time.Second); d < 0 || d >= time.Second {
+			t.Fatalf("jitter out of range: %s", d)
+		}
+	}
+}
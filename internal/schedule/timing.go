@@ -0,0 +1,57 @@
+package schedule
+
+import (
+	"math/rand"
+	"time"
+)
+
+// maxBackoffShift caps the doubling in Backoff; max bounds it long before.
+const maxBackoffShift = 16
+
+// NextAfter returns the first slot of s after prev that is still after now,
+// and how many slots it skipped because they had already passed. A
+// destination's worker runs one sync at a time, so slots that pass while a
+// run is still going are skipped rather than run back to back.
+func NextAfter(s Schedule, prev, now time.Time) (next time.Time, skipped int) {
+	next = s.Next(prev)
+	for !next.IsZero() && !next.After(now) {
+		next = s.Next(next)
+		skipped++
+	}
+	return next, skipped
+}
+
+// Backoff pushes next back after failures consecutive failed runs by
+// skipping 2^(failures-1)-1 further slots: none after the first failure,
+// then 1, 3, 7, ..., so the gap between attempts roughly doubles. It never
+// moves next past now+max, and max <= 0 disables it. It returns the new
+// slot and how many slots were skipped.
+func Backoff(s Schedule, next time.Time, failures int, max time.Duration, now time.Time) (time.Time, int) {
+	if failures < 2 || max <= 0 || next.IsZero() {
+		return next, 0
+	}
+	shift := failures - 1
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+	want := 1<<shift - 1
+	limit := now.Add(max)
+	skipped := 0
+	for skipped < want {
+		n := s.Next(next)
+		if n.IsZero() || n.After(limit) {
+			break
+		}
+		next = n
+		skipped++
+	}
+	return next, skipped
+}
+
+// Jitter returns a random delay in [0, max), or 0 when max <= 0.
+func Jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
@@ -0,0 +1,158 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Admin action results, reported per destination.
+const (
+	resultTriggered     = "triggered"
+	resultAlreadyQueued = "already_queued"
+	resultPaused        = "paused"
+	resultResumed       = "resumed"
+	resultCancelled     = "cancelled"
+	resultNotRunning    = "not_running"
+	resultDryRunOn      = "dry_run_enabled"
+	resultDryRunOff     = "dry_run_disabled"
+)
+
+// EnableAdmin turns on the /admin endpoints, authenticated with
+// "Authorization: Bearer <token>". Without it they respond 404.
+func (ms *MultiState) EnableAdmin(token string) {
+	ms.adminToken = token
+}
+
+// adminOnly wraps h so it only serves authenticated POST requests.
+func (ms *MultiState) adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if ms.adminToken == "" {
+			writeError(w, http.StatusNotFound, "admin API not enabled")
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !secureEqual(got, ms.adminToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rd-mirror-sync"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// adminTargets resolves the ?dest= parameter to destination names: the one
+// named, or all of them when omitted.
+func (ms *MultiState) adminTargets(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	dest := r.URL.Query().Get("dest")
+	if dest == "" {
+		return ms.names, true
+	}
+	if _, ok := ms.controls[dest]; !ok {
+		writeError(w, http.StatusNotFound, "unknown destination")
+		return nil, false
+	}
+	return []string{dest}, true
+}
+
+// writeResults writes per-destination results. A single-destination request
+// whose action could not be applied gets 409 so scripts can tell.
+func writeResults(w http.ResponseWriter, code int, results map[string]string, conflict bool) {
+	if conflict && len(results) == 1 {
+		code = http.StatusConflict
+	}
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
+
+// POST /admin/run[?dest=x] — queue an immediate run.
+func (ms *MultiState) handleAdminRun(w http.ResponseWriter, r *http.Request) {
+	names, ok := ms.adminTargets(w, r)
+	if !ok {
+		return
+	}
+	results := make(map[string]string, len(names))
+	conflict := false
+	for _, n := range names {
+		c := ms.controls[n]
+		switch {
+		case c.Paused():
+			results[n] = resultPaused
+			conflict = true
+		case c.Trigger():
+			results[n] = resultTriggered
+		default:
+			results[n] = resultAlreadyQueued
+		}
+	}
+	writeResults(w, http.StatusAccepted, results, conflict)
+}
+
+// POST /admin/pause[?dest=x] and /admin/resume[?dest=x].
+func (ms *MultiState) handleAdminPause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names, ok := ms.adminTargets(w, r)
+		if !ok {
+			return
+		}
+		result := resultResumed
+		if paused {
+			result = resultPaused
+		}
+		results := make(map[string]string, len(names))
+		for _, n := range names {
+			ms.controls[n].SetPaused(paused)
+			results[n] = result
+		}
+		writeResults(w, http.StatusOK, results, false)
+	}
+}
+
+// POST /admin/dry-run?enabled=true|false[&dest=x] — takes effect on the next run.
+func (ms *MultiState) handleAdminDryRun(w http.ResponseWriter, r *http.Request) {
+	enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "enabled must be true or false")
+		return
+	}
+	names, ok := ms.adminTargets(w, r)
+	if !ok {
+		return
+	}
+	result := resultDryRunOff
+	if enabled {
+		result = resultDryRunOn
+	}
+	results := make(map[string]string, len(names))
+	for _, n := range names {
+		ms.controls[n].SetDryRun(enabled)
+		results[n] = result
+	}
+	writeResults(w, http.StatusOK, results, false)
+}
+
+// POST /admin/cancel[?dest=x] — cancel the in-progress run.
+func (ms *MultiState) handleAdminCancel(w http.ResponseWriter, r *http.Request) {
+	names, ok := ms.adminTargets(w, r)
+	if !ok {
+		return
+	}
+	results := make(map[string]string, len(names))
+	conflict := false
+	for _, n := range names {
+		if ms.controls[n].Cancel() {
+			results[n] = resultCancelled
+		} else {
+			results[n] = resultNotRunning
+			conflict = true
+		}
+	}
+	writeResults(w, http.StatusOK, results, conflict)
+}
@@ -0,0 +1,106 @@
+package status
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	ms := NewMultiState([]string{"a"}, time.Minute)
+	h := ms.Handler()
+
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/run", "secret"); rec.Code != http.StatusNotFound {
+		t.Fatalf("admin disabled: got %d, want 404", rec.Code)
+	}
+
+	ms.EnableAdmin("secret")
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/run", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("missing token: got %d, want 401", rec.Code)
+	}
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/run", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: got %d, want 401", rec.Code)
+	}
+	if rec := adminRequest(t, h, http.MethodGet, "/admin/run", "secret"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: got %d, want 405", rec.Code)
+	}
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/run", "secret"); rec.Code != http.StatusAccepted {
+		t.Fatalf("valid request: got %d, want 202", rec.Code)
+	}
+}
+
+func TestAdminTriggerPauseAndDryRun(t *testing.T) {
+	ms := NewMultiState([]string{"a", "b"}, time.Minute)
+	ms.EnableAdmin("secret")
+	h := ms.Handler()
+
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/run?dest=a", "secret"); rec.Code != http.StatusAccepted {
+		t.Fatalf("trigger: got %d", rec.Code)
+	}
+	select {
+	case <-ms.Control("a").Triggered():
+	default:
+		t.Fatal("expected a run queued for a")
+	}
+	select {
+	case <-ms.Control("b").Triggered():
+		t.Fatal("did not expect a run queued for b")
+	default:
+	}
+
+	adminRequest(t, h, http.MethodPost, "/admin/pause?dest=a", "secret")
+	if !ms.Control("a").Paused() || ms.Control("b").Paused() {
+		t.Fatal("expected only a paused")
+	}
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/run?dest=a", "secret"); rec.Code != http.StatusConflict {
+		t.Fatalf("trigger paused destination: got %d, want 409", rec.Code)
+	}
+	adminRequest(t, h, http.MethodPost, "/admin/resume?dest=a", "secret")
+	if ms.Control("a").Paused() {
+		t.Fatal("expected a resumed")
+	}
+
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/dry-run?enabled=maybe", "secret"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad enabled value: got %d, want 400", rec.Code)
+	}
+	adminRequest(t, h, http.MethodPost, "/admin/dry-run?enabled=true", "secret")
+	if !ms.Control("a").DryRun() || !ms.Control("b").DryRun() {
+		t.Fatal("expected dry_run enabled on all destinations")
+	}
+
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/run?dest=nope", "secret"); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown destination: got %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminCancel(t *testing.T) {
+	ms := NewMultiState([]string{"a"}, time.Minute)
+	ms.EnableAdmin("secret")
+	h := ms.Handler()
+
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/cancel?dest=a", "secret"); rec.Code != http.StatusConflict {
+		t.Fatalf("cancel with no run: got %d, want 409", rec.Code)
+	}
+
+	runCtx, end := ms.Control("a").BeginRun(context.Background())
+	defer end()
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/cancel?dest=a", "secret"); rec.Code != http.StatusOK {
+		t.Fatalf("cancel running: got %d, want 200", rec.Code)
+	}
+	if runCtx.Err() == nil {
+		t.Fatal("expected run context cancelled")
+	}
+}
@@ -0,0 +1,79 @@
+package status
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Auth protects the health server's detailed views. With neither a bearer
+// token nor basic credentials set, every request is treated as authorized.
+type Auth struct {
+	BearerToken   string
+	BasicUser     string
+	BasicPassword string
+}
+
+func (a Auth) enabled() bool {
+	return a.BearerToken != "" || a.BasicUser != ""
+}
+
+// authorized reports whether r carries valid credentials, or auth is off.
+func (a Auth) authorized(r *http.Request) bool {
+	if !a.enabled() {
+		return true
+	}
+	if a.BearerToken != "" {
+		if got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && secureEqual(got, a.BearerToken) {
+			return true
+		}
+	}
+	if a.BasicUser != "" {
+		if user, pass, ok := r.BasicAuth(); ok && secureEqual(user, a.BasicUser) && secureEqual(pass, a.BasicPassword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Auth) challenge(w http.ResponseWriter) {
+	if a.BasicUser != "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="rd-mirror-sync"`)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="rd-mirror-sync"`)
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// SetAuth protects everything except the /healthz summary with auth.
+// Unauthenticated /healthz requests get only health/running/timestamps, no
+// error strings or counts.
+func (ms *MultiState) SetAuth(a Auth) {
+	ms.auth = a
+}
+
+// protected wraps h so it requires ms.auth credentials.
+func (ms *MultiState) protected(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ms.auth.authorized(r) {
+			w.Header().Set("Content-Type", "application/json")
+			ms.auth.challenge(w)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// publicSnapshot strips a /healthz entry down to what is safe to show
+// without credentials.
+func publicSnapshot(snap map[string]any) map[string]any {
+	out := make(map[string]any, 6)
+	for _, k := range []string{"healthy", "health", "reason", "running", "last_run_at", "last_success_at"} {
+		out[k] = snap[k]
+	}
+	return out
+}
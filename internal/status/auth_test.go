@@ -0,0 +1,79 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+var errSecret = errors.New("GET https://example.invalid/torrents?page=1: status=502")
+
+func TestAuthPublicHealthzSummary(t *testing.T) {
+	ms := NewMultiState([]string{"a"}, time.Minute)
+	ms.For("a").MarkResult(syncer.Stats{}, errSecret, false)
+	ms.SetAuth(Auth{BearerToken: "secret"})
+	h := ms.Handler()
+
+	get := func(target string, mod func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if mod != nil {
+			mod(req)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/healthz?dest=a", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("public /healthz: got %d, want 200", rec.Code)
+	}
+	var snap map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &snap)
+	if _, ok := snap["last_error"]; ok {
+		t.Fatalf("public /healthz leaked last_error: %v", snap)
+	}
+	if _, ok := snap["healthy"]; !ok {
+		t.Fatalf("public /healthz missing healthy: %v", snap)
+	}
+
+	rec = get("/healthz?dest=a", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") })
+	snap = nil
+	_ = json.Unmarshal(rec.Body.Bytes(), &snap)
+	if snap["last_error"] != errSecret.Error() {
+		t.Fatalf("authenticated /healthz should be detailed, got %v", snap)
+	}
+
+	for _, path := range []string{"/metrics", "/plan", "/approvals"} {
+		if rec := get(path, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s without credentials: got %d, want 401", path, rec.Code)
+		}
+	}
+	if rec := get("/metrics", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }); rec.Code != http.StatusOK {
+		t.Errorf("/metrics with token: got %d, want 200", rec.Code)
+	}
+}
+
+func TestAuthBasic(t *testing.T) {
+	a := Auth{BasicUser: "u", BasicPassword: "p"}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if a.authorized(req) {
+		t.Fatal("expected request without credentials to be rejected")
+	}
+	req.SetBasicAuth("u", "wrong")
+	if a.authorized(req) {
+		t.Fatal("expected wrong password to be rejected")
+	}
+	req.SetBasicAuth("u", "p")
+	if !a.authorized(req) {
+		t.Fatal("expected valid basic credentials to be accepted")
+	}
+	if !(Auth{}).authorized(httptest.NewRequest(http.MethodGet, "/", nil)) {
+		t.Fatal("expected zero Auth to allow everything")
+	}
+}
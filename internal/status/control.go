@@ -0,0 +1,93 @@
+package status
+
+import (
+	"context"
+	"sync"
+)
+
+// Control holds the runtime switches for one destination's worker: pause,
+// dry-run override, on-demand triggers and cancellation of the current run.
+// The admin API writes them; the worker goroutine reads them between runs.
+type Control struct {
+	mu      sync.Mutex
+	paused  bool
+	dryRun  bool
+	cancel  context.CancelFunc
+	trigger chan struct{}
+}
+
+// NewControl returns a Control starting unpaused with the given dry-run setting.
+func NewControl(dryRun bool) *Control {
+	return &Control{
+		dryRun:  dryRun,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Trigger queues an immediate run. It reports false if a run is already
+// queued; at most one triggered run is pending at a time.
+func (c *Control) Trigger() bool {
+	select {
+	case c.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Triggered is signalled once per queued Trigger.
+func (c *Control) Triggered() <-chan struct{} {
+	return c.trigger
+}
+
+// SetPaused pauses or resumes scheduled and triggered runs.
+func (c *Control) SetPaused(v bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = v
+}
+
+func (c *Control) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// SetDryRun changes the dry-run setting used from the next run on.
+func (c *Control) SetDryRun(v bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dryRun = v
+}
+
+func (c *Control) DryRun() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dryRun
+}
+
+// BeginRun derives a cancellable context for a run and registers it so
+// Cancel can stop it. The returned func must be called when the run ends.
+func (c *Control) BeginRun(ctx context.Context) (context.Context, context.CancelFunc) {
+	runCtx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+	return runCtx, func() {
+		c.mu.Lock()
+		c.cancel = nil
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// Cancel stops the in-progress run, reporting false if none is running.
+func (c *Control) Cancel() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel == nil {
+		return false
+	}
+	c.cancel()
+	return true
+}
@@ -0,0 +1,97 @@
+package status
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"rdmirrorsync/internal/audit"
+	"rdmirrorsync/internal/syncer"
+)
+
+// defaultAuditLimit caps /audit responses when no limit is given.
+const defaultAuditLimit = 100
+
+//go:embed ui
+var uiFiles embed.FS
+
+// SetAuditLog enables GET /audit, reading the audit log at path.
+func (ms *MultiState) SetAuditLog(path string) {
+	ms.auditPath = path
+}
+
+// uiHandler serves the embedded dashboard under /ui/. The static files hold
+// no data, so they are public; the page fetches everything else with the
+// credentials the user enters.
+func uiHandler() http.Handler {
+	sub, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err) // the embedded tree is fixed at build time
+	}
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(sub)))
+}
+
+// GET / — redirect to the dashboard.
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	http.Redirect(w, r, "/ui/", http.StatusFound)
+}
+
+// GET /ui/meta — which optional features the dashboard should show. It only
+// reveals whether features are on, never their settings.
+func (ms *MultiState) handleUIMeta(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"destinations":  ms.names,
+		"bearer_auth":   ms.auth.BearerToken != "",
+		"admin_enabled": ms.adminToken != "",
+		"audit_enabled": ms.auditPath != "",
+		"approvals":     ms.approvals != nil,
+	})
+}
+
+// GET /audit[?dest=x][&hash=h][&action=add|delete][&limit=n] — newest audit
+// log entries first.
+func (ms *MultiState) handleAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if ms.auditPath == "" {
+		writeError(w, http.StatusNotFound, "audit log not enabled")
+		return
+	}
+	q := r.URL.Query()
+	f := audit.Filter{
+		Dest:   q.Get("dest"),
+		Hash:   q.Get("hash"),
+		Action: q.Get("action"),
+		Limit:  defaultAuditLimit,
+	}
+	if f.Action != "" && f.Action != syncer.ActionAdd && f.Action != syncer.ActionDelete {
+		writeError(w, http.StatusBadRequest, "action must be add or delete")
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		f.Limit = n
+	}
+
+	events, err := audit.Read(ms.auditPath, f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make([]syncer.AuditEvent, len(events))
+	for i, e := range events {
+		out[len(events)-1-i] = e
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
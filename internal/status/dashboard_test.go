@@ -0,0 +1,138 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/audit"
+	"rdmirrorsync/internal/syncer"
+)
+
+func TestDashboardServed(t *testing.T) {
+	ms := NewMultiState([]string{"a"}, time.Minute)
+	ms.SetAuth(Auth{BearerToken: "secret"})
+	h := ms.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/ui/" {
+		t.Fatalf("GET /: got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// Static files need no credentials; they carry no data.
+	for _, path := range []string{"/ui/", "/ui/app.js", "/ui/style.css"} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Fatalf("GET %s: got %d", path, rec.Code)
+		}
+	}
+	if !strings.Contains(rec.Header().Get("Content-Type"), "text/css") {
+		t.Fatalf("style.css content type %q", rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown path: got %d", rec.Code)
+	}
+}
+
+func TestDashboardMeta(t *testing.T) {
+	ms := NewMultiState([]string{"a", "b"}, time.Minute)
+	ms.SetAuth(Auth{BearerToken: "secret"})
+	ms.EnableAdmin("admin-secret")
+
+	rec := httptest.NewRecorder()
+	ms.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/meta", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Fatalf("meta leaks a token: %s", rec.Body)
+	}
+	var meta struct {
+		Destinations []string `json:"destinations"`
+		BearerAuth   bool     `json:"bearer_auth"`
+		Admin        bool     `json:"admin_enabled"`
+		Audit        bool     `json:"audit_enabled"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Destinations) != 2 || !meta.BearerAuth || !meta.Admin || meta.Audit {
+		t.Fatalf("unexpected meta: %+v", meta)
+	}
+}
+
+func TestAuditEndpoint(t *testing.T) {
+	ms := NewMultiState([]string{"a", "b"}, time.Minute)
+	h := ms.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/audit", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("audit disabled: got %d", rec.Code)
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, e := range []syncer.AuditEvent{
+		{Dest: "a", Action: syncer.ActionAdd, Hash: "aaa"},
+		{Dest: "b", Action: syncer.ActionDelete, Hash: "bbb"},
+		{Dest: "a", Action: syncer.ActionDelete, Hash: "ccc", Error: "status=500"},
+	} {
+		e.Time = base.Add(time.Duration(i) * time.Hour)
+		if err := l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ms.SetAuditLog(path)
+
+	get := func(target string) []syncer.AuditEvent {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", target, rec.Code, rec.Body)
+		}
+		var events []syncer.AuditEvent
+		if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+
+	if got := get("/audit"); len(got) != 3 || got[0].Hash != "ccc" || got[2].Hash != "aaa" {
+		t.Fatalf("want newest first, got %+v", got)
+	}
+	if got := get("/audit?dest=a&limit=1"); len(got) != 1 || got[0].Hash != "ccc" {
+		t.Fatalf("dest=a limit=1: %+v", got)
+	}
+	if got := get("/audit?action=add"); len(got) != 1 || got[0].Hash != "aaa" {
+		t.Fatalf("action=add: %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/audit?action=nuke", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad action: got %d", rec.Code)
+	}
+
+	ms.SetAuth(Auth{BearerToken: "secret"})
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/audit", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated: got %d", rec.Code)
+	}
+}
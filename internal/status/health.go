@@ -0,0 +1,133 @@
+package status
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Health levels reported by /healthz, from best to worst.
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthFailing  = "failing"
+)
+
+// stuckGrace is how long past RunTimeout a run may keep going before it is
+// reported stuck. Writes already in flight when the timeout fires still
+// finish, so a run can overrun its deadline slightly.
+const stuckGrace = time.Minute
+
+// HealthPolicy sets the thresholds that turn run results into a health level.
+type HealthPolicy struct {
+	// FailAfter consecutive failed runs make a destination failing; fewer
+	// make it degraded.
+	FailAfter int
+	// A finished run whose share of failed adds and deletes is above
+	// DegradedErrorRatio is degraded, and at or above FailingErrorRatio
+	// failing.
+	DegradedErrorRatio float64
+	FailingErrorRatio  float64
+	// RunTimeout, when set, marks a run still going after RunTimeout plus a
+	// grace period as stuck, and so failing.
+	RunTimeout time.Duration
+}
+
+// DefaultHealthPolicy is used until SetHealthPolicy is called: three failed
+// runs in a row or a run where every add and delete failed is failing, any
+// failure short of that is degraded.
+func DefaultHealthPolicy() HealthPolicy {
+	return HealthPolicy{FailAfter: 3, DegradedErrorRatio: 0, FailingErrorRatio: 1}
+}
+
+// SetHealthPolicy changes the thresholds used by /healthz.
+func (ms *MultiState) SetHealthPolicy(p HealthPolicy) {
+	ms.policy = p
+}
+
+// health grades the destination at now. s.mu must be held. Paused
+// destinations are not expected to run, so they never go stale.
+func (s *State) health(p HealthPolicy, interval time.Duration, paused bool, now time.Time) (level, reason string) {
+	if s.gap > 0 {
+		interval = s.gap
+	}
+	if d, ok := s.stuck(p, now); ok {
+		return HealthFailing, fmt.Sprintf("run stuck for %s (run_timeout %s)", d.Round(time.Second), p.RunTimeout)
+	}
+	if p.FailAfter > 0 && s.failures >= p.FailAfter {
+		return HealthFailing, fmt.Sprintf("%d consecutive failed runs", s.failures)
+	}
+	// Allow the failures FailAfter tolerates before calling the destination stale.
+	staleAfter := 2 * interval
+	if n := time.Duration(p.FailAfter+1) * interval; n > staleAfter {
+		staleAfter = n
+	}
+	if !paused && !s.lastSuccessAt.IsZero() && interval > 0 && now.Sub(s.lastSuccessAt) > staleAfter {
+		return HealthFailing, fmt.Sprintf("no successful run for %s", now.Sub(s.lastSuccessAt).Round(time.Second))
+	}
+
+	failed, attempted := s.itemErrors()
+	ratio := 0.0
+	if attempted > 0 {
+		ratio = float64(failed) / float64(attempted)
+	}
+	if s.lastOK && attempted > 0 && ratio >= p.FailingErrorRatio {
+		return HealthFailing, fmt.Sprintf("%d of %d adds and deletes failed in the last run", failed, attempted)
+	}
+	if s.failures > 0 {
+		return HealthDegraded, fmt.Sprintf("%d consecutive failed runs", s.failures)
+	}
+	if s.lastOK && ratio > p.DegradedErrorRatio {
+		return HealthDegraded, fmt.Sprintf("%d of %d adds and deletes failed in the last run", failed, attempted)
+	}
+	if s.lastRunAt.IsZero() && s.lastSuccessAt.IsZero() {
+		return HealthDegraded, "waiting for the first run"
+	}
+	return HealthOK, ""
+}
+
+// stuck reports whether the current run has overrun p.RunTimeout by more
+// than stuckGrace, and for how long it has been going. s.mu must be held.
+func (s *State) stuck(p HealthPolicy, now time.Time) (time.Duration, bool) {
+	if !s.running || p.RunTimeout <= 0 {
+		return 0, false
+	}
+	d := now.Sub(s.lastRunAt)
+	return d, d > p.RunTimeout+stuckGrace
+}
+
+// itemErrors returns the failed and attempted adds, resumes and deletes
+// (including dedupes) of the last finished run.
+func (s *State) itemErrors() (failed, attempted int) {
+	st := s.lastStats
+	failed = st.AddErrors + st.DeleteErrors
+	return failed, failed + st.Added + st.Resumed + st.Deleted + st.Deduped
+}
+
+// worseHealth returns the worse of two health levels.
+func worseHealth(a, b string) string {
+	if healthRank(b) > healthRank(a) {
+		return b
+	}
+	return a
+}
+
+// healthStatusCode is the /healthz status for a level: 503 when failing so
+// plain HTTP uptime checks notice.
+func healthStatusCode(level string) int {
+	if level == HealthFailing {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+func healthRank(level string) int {
+	switch level {
+	case HealthFailing:
+		return 2
+	case HealthDegraded:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,109 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+func TestHealthLevels(t *testing.T) {
+	p := HealthPolicy{FailAfter: 2, DegradedErrorRatio: 0.1, FailingErrorRatio: 1, RunTimeout: time.Minute}
+	now := time.Now()
+	cases := []struct {
+		name  string
+		state *State
+		want  string
+	}{
+		{"no run yet", &State{}, HealthDegraded},
+		{"ok", &State{lastRunAt: now, lastSuccessAt: now, lastOK: true}, HealthOK},
+		{"one failure", &State{lastRunAt: now, lastSuccessAt: now, failures: 1}, HealthDegraded},
+		{"failures reach threshold", &State{lastRunAt: now, lastSuccessAt: now, failures: 2}, HealthFailing},
+		{"few item errors", &State{lastRunAt: now, lastSuccessAt: now, lastOK: true,
+			lastStats: syncer.Stats{Added: 19, AddErrors: 1}}, HealthOK},
+		{"item errors over degraded ratio", &State{lastRunAt: now, lastSuccessAt: now, lastOK: true,
+			lastStats: syncer.Stats{Added: 5, AddErrors: 5}}, HealthDegraded},
+		{"every item failed", &State{lastRunAt: now, lastSuccessAt: now, lastOK: true,
+			lastStats: syncer.Stats{AddErrors: 3, DeleteErrors: 1}}, HealthFailing},
+		{"stale", &State{lastRunAt: now, lastSuccessAt: now.Add(-time.Hour), lastOK: true}, HealthFailing},
+		{"long run within timeout", &State{running: true, lastRunAt: now.Add(-time.Minute), lastSuccessAt: now}, HealthOK},
+		{"stuck run", &State{running: true, lastRunAt: now.Add(-5 * time.Minute), lastSuccessAt: now}, HealthFailing},
+	}
+	for _, tc := range cases {
+		got, reason := tc.state.health(p, time.Minute, false, now)
+		if got != tc.want {
+			t.Errorf("%s: got %s (%s), want %s", tc.name, got, reason, tc.want)
+		}
+		if (got == HealthOK) != (reason == "") {
+			t.Errorf("%s: level %s with reason %q", tc.name, got, reason)
+		}
+	}
+
+	stale := &State{lastRunAt: now, lastSuccessAt: now.Add(-time.Hour), lastOK: true}
+	if got, _ := stale.health(p, time.Minute, true, now); got != HealthOK {
+		t.Errorf("paused destination should not go stale, got %s", got)
+	}
+}
+
+func TestHealthzStatusCode(t *testing.T) {
+	ms := NewMultiState([]string{"a", "b"}, time.Minute)
+	ms.SetHealthPolicy(HealthPolicy{FailAfter: 2, FailingErrorRatio: 1})
+	ms.For("b").MarkResult(syncer.Stats{Added: 1}, nil, false)
+	h := ms.Handler()
+
+	get := func(target string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, body
+	}
+
+	ms.For("a").MarkResult(syncer.Stats{}, errors.New("status=503"), false)
+	code, body := get("/healthz")
+	if code != http.StatusOK || body["health"] != HealthDegraded || body["healthy"] != true {
+		t.Fatalf("one failure: %d %v", code, body)
+	}
+
+	ms.For("a").MarkResult(syncer.Stats{}, errors.New("status=503"), false)
+	code, body = get("/healthz")
+	if code != http.StatusServiceUnavailable || body["health"] != HealthFailing || body["healthy"] != false {
+		t.Fatalf("two failures: %d %v", code, body)
+	}
+	code, body = get("/healthz?dest=a")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body["reason"].(string), "2 consecutive") {
+		t.Fatalf("dest=a: %d %v", code, body)
+	}
+	if code, body = get("/healthz?dest=b"); code != http.StatusOK || body["health"] != HealthOK {
+		t.Fatalf("dest=b: %d %v", code, body)
+	}
+
+	ms.For("a").MarkResult(syncer.Stats{Added: 1}, nil, false)
+	if code, body = get("/healthz"); code != http.StatusOK || body["health"] != HealthOK {
+		t.Fatalf("recovered: %d %v", code, body)
+	}
+}
+
+func TestCancelledRunsDoNotCountAsFailures(t *testing.T) {
+	p := HealthPolicy{FailAfter: 2, FailingErrorRatio: 1}
+	st := NewState()
+	st.MarkStart()
+	st.MarkResult(syncer.Stats{Added: 1}, nil, false)
+	for i := 0; i < 3; i++ {
+		st.MarkStart()
+		st.MarkResult(syncer.Stats{AddErrors: 1, Interrupted: true}, syncer.ErrInterrupted, true)
+	}
+	if got, reason := st.health(p, 0, false, time.Now()); got != HealthOK {
+		t.Fatalf("after cancelled runs: %s (%s)", got, reason)
+	}
+	if runs := st.history.newestFirst(0); len(runs) != 4 || !runs[0].Cancelled || runs[0].OK {
+		t.Fatalf("history: %+v", runs)
+	}
+}
@@ -0,0 +1,110 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+// DefaultHistorySize is how many runs each destination remembers.
+const DefaultHistorySize = 50
+
+// RunRecord summarises one finished run.
+type RunRecord struct {
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Duration   float64      `json:"duration_seconds"`
+	OK         bool         `json:"ok"`
+	Cancelled  bool         `json:"cancelled,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Stats      syncer.Stats `json:"stats"`
+}
+
+// history is a fixed-size ring buffer of runs, oldest overwritten first.
+type history struct {
+	runs []RunRecord
+	next int
+	full bool
+}
+
+func newHistory(size int) history {
+	if size < 1 {
+		size = 1
+	}
+	return history{runs: make([]RunRecord, size)}
+}
+
+func (h *history) add(r RunRecord) {
+	h.runs[h.next] = r
+	h.next = (h.next + 1) % len(h.runs)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// newestFirst returns up to limit runs, most recent first; limit <= 0 means all.
+func (h *history) newestFirst(limit int) []RunRecord {
+	n := h.next
+	if h.full {
+		n = len(h.runs)
+	}
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	out := make([]RunRecord, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, h.runs[(h.next-i+len(h.runs))%len(h.runs)])
+	}
+	return out
+}
+
+// History returns up to limit recent runs, newest first; limit <= 0 means all
+// that are kept.
+func (s *State) History(limit int) []RunRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.history.newestFirst(limit)
+}
+
+// SetHistorySize changes how many runs each destination keeps, discarding
+// the history recorded so far. Call it before the first run.
+func (ms *MultiState) SetHistorySize(n int) {
+	for _, st := range ms.states {
+		st.mu.Lock()
+		st.history = newHistory(n)
+		st.mu.Unlock()
+	}
+}
+
+// GET /history[?dest=x][&limit=n] — recent runs, newest first.
+func (ms *MultiState) handleHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+
+	if dest := q.Get("dest"); dest != "" {
+		st, ok := ms.states[dest]
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown destination")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"dest": dest, "runs": st.History(limit)})
+		return
+	}
+	all := make(map[string][]RunRecord, len(ms.names))
+	for _, n := range ms.names {
+		all[n] = ms.states[n].History(limit)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"destinations": all})
+}
@@ -0,0 +1,64 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+func TestHistoryRingBuffer(t *testing.T) {
+	h := newHistory(3)
+	if got := h.newestFirst(0); len(got) != 0 {
+		t.Fatalf("empty history: %+v", got)
+	}
+	for i := 1; i <= 5; i++ {
+		h.add(RunRecord{Stats: syncer.Stats{Added: i}})
+	}
+	got := h.newestFirst(0)
+	if len(got) != 3 || got[0].Stats.Added != 5 || got[2].Stats.Added != 3 {
+		t.Fatalf("want runs 5,4,3, got %+v", got)
+	}
+	if got := h.newestFirst(2); len(got) != 2 || got[1].Stats.Added != 4 {
+		t.Fatalf("limit 2: %+v", got)
+	}
+}
+
+func TestHistoryEndpoint(t *testing.T) {
+	ms := NewMultiState([]string{"a", "b"}, time.Minute)
+	ms.SetHistorySize(2)
+	st := ms.For("a")
+	st.MarkStart()
+	st.MarkResult(syncer.Stats{Added: 1}, nil, false)
+	st.MarkStart()
+	st.MarkResult(syncer.Stats{}, errors.New("list torrents: status=503"), false)
+
+	rec := httptest.NewRecorder()
+	ms.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history?dest=a", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Dest string      `json:"dest"`
+		Runs []RunRecord `json:"runs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Runs) != 2 || body.Runs[0].OK || body.Runs[0].Error == "" || !body.Runs[1].OK || body.Runs[1].Stats.Added != 1 {
+		t.Fatalf("unexpected runs: %+v", body.Runs)
+	}
+	if body.Runs[0].FinishedAt.Before(body.Runs[0].StartedAt) {
+		t.Fatalf("finished before started: %+v", body.Runs[0])
+	}
+
+	rec = httptest.NewRecorder()
+	ms.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history?dest=nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown dest: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,85 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"rdmirrorsync/internal/lists"
+)
+
+// SetLists enables GET /lists and the /admin/lists endpoints, backed by store.
+func (ms *MultiState) SetLists(store *lists.Store) {
+	ms.lists = store
+}
+
+// GET /lists[?dest=x] — each destination's ignore and pin lists.
+func (ms *MultiState) handleLists(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if ms.lists == nil {
+		writeError(w, http.StatusNotFound, "lists not enabled")
+		return
+	}
+	names := ms.names
+	if dest := r.URL.Query().Get("dest"); dest != "" {
+		if _, ok := ms.states[dest]; !ok {
+			writeError(w, http.StatusNotFound, "unknown destination")
+			return
+		}
+		names = []string{dest}
+	}
+	out := make(map[string]lists.Lists, len(names))
+	for _, n := range names {
+		l, err := ms.lists.Get(n)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		out[n] = l
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// POST /admin/lists/add?dest=x&list=ignore|pin&hash=h[&note=text] and
+// /admin/lists/remove?dest=x&list=ignore|pin&hash=h — applies from the
+// destination's next run.
+func (ms *MultiState) handleListEdit(add bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ms.lists == nil {
+			writeError(w, http.StatusNotFound, "lists not enabled")
+			return
+		}
+		q := r.URL.Query()
+		dest := q.Get("dest")
+		if dest == "" {
+			writeError(w, http.StatusBadRequest, "dest is required")
+			return
+		}
+		if _, ok := ms.states[dest]; !ok {
+			writeError(w, http.StatusNotFound, "unknown destination")
+			return
+		}
+
+		var changed bool
+		var err error
+		if add {
+			changed, err = ms.lists.Add(dest, q.Get("list"), q.Get("hash"), q.Get("note"))
+		} else {
+			changed, err = ms.lists.Remove(dest, q.Get("list"), q.Get("hash"))
+		}
+		switch {
+		case errors.Is(err, lists.ErrInvalidHash), errors.Is(err, lists.ErrUnknownList):
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		l, err := ms.lists.Get(dest)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"changed": changed, "lists": l})
+	}
+}
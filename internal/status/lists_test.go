@@ -0,0 +1,54 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/lists"
+)
+
+func TestListsEndpoints(t *testing.T) {
+	ms := NewMultiState([]string{"a", "b"}, time.Minute)
+	ms.EnableAdmin("secret")
+	ms.SetLists(lists.NewStore(t.TempDir()))
+	h := ms.Handler()
+
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/lists/add?dest=a&list=pin&hash=ABC&note=keep", "secret"); rec.Code != http.StatusOK {
+		t.Fatalf("add: got %d: %s", rec.Code, rec.Body)
+	}
+	for target, want := range map[string]int{
+		"/admin/lists/add?list=pin&hash=abc":             http.StatusBadRequest,
+		"/admin/lists/add?dest=zzz&list=pin&hash=abc":    http.StatusNotFound,
+		"/admin/lists/add?dest=a&list=nope&hash=abc":     http.StatusBadRequest,
+		"/admin/lists/add?dest=a&list=ignore&hash=xyz!!": http.StatusBadRequest,
+	} {
+		if rec := adminRequest(t, h, http.MethodPost, target, "secret"); rec.Code != want {
+			t.Errorf("%s: got %d, want %d", target, rec.Code, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lists", nil))
+	var got map[string]lists.Lists
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got["a"].Pin) != 1 || got["a"].Pin[0].Hash != "abc" || got["a"].Pin[0].Note != "keep" || len(got["b"].Pin) != 0 {
+		t.Fatalf("GET /lists: %+v", got)
+	}
+
+	rec = adminRequest(t, h, http.MethodPost, "/admin/lists/remove?dest=a&list=pin&hash=abc", "secret")
+	var out struct {
+		Changed bool        `json:"changed"`
+		Lists   lists.Lists `json:"lists"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || !out.Changed || len(out.Lists.Pin) != 0 {
+		t.Fatalf("remove: %d %+v", rec.Code, out)
+	}
+}
@@ -0,0 +1,32 @@
+package status
+
+import (
+	"fmt"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+// PanicRecord is a panic recovered from a destination's worker.
+type PanicRecord struct {
+	At    time.Time `json:"at"`
+	Value string    `json:"value"`
+	Stack string    `json:"stack"`
+}
+
+// MarkPanic records a panic recovered from the destination's worker, which
+// is restarted unless the process is stopping. A run the panic cut short
+// counts as failed.
+func (s *State) MarkPanic(v any, stack []byte, restarting bool) {
+	s.mu.Lock()
+	if restarting {
+		s.restarts++
+	}
+	s.lastPanic = &PanicRecord{At: time.Now(), Value: fmt.Sprint(v), Stack: string(stack)}
+	running := s.running
+	s.mu.Unlock()
+
+	if running {
+		s.MarkResult(syncer.Stats{}, fmt.Errorf("panic: %v", v), false)
+	}
+}
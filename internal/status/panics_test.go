@@ -0,0 +1,31 @@
+package status
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarkPanicFailsRunAndShowsInHealthz(t *testing.T) {
+	ms := NewMultiState([]string{"a"}, time.Minute)
+	st := ms.For("a")
+	st.MarkStart()
+	st.MarkPanic("assignment to entry in nil map", []byte("goroutine 7 [running]:\n..."), true)
+
+	code, snap := probe(t, ms.Handler(), "/healthz?dest=a")
+	if code != 200 || snap["health"] != HealthDegraded || snap["running"] != false {
+		t.Fatalf("got %d %v", code, snap)
+	}
+	if snap["restarts"] != float64(1) || snap["last_error"] != "panic: assignment to entry in nil map" {
+		t.Fatalf("restarts %v, last_error %v", snap["restarts"], snap["last_error"])
+	}
+	p, _ := snap["last_panic"].(map[string]any)
+	if p["value"] != "assignment to entry in nil map" || p["stack"] == "" {
+		t.Fatalf("last_panic: %v", snap["last_panic"])
+	}
+
+	// A panic between runs is recorded without inventing a failed run.
+	st.MarkPanic("boom", nil, true)
+	if _, snap = probe(t, ms.Handler(), "/healthz?dest=a"); snap["consecutive_failures"] != float64(1) || snap["restarts"] != float64(2) {
+		t.Fatalf("second panic: %v", snap)
+	}
+}
@@ -0,0 +1,100 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// MarkStopped records that the destination's worker goroutine has exited,
+// which makes /livez fail.
+func (s *State) MarkStopped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+}
+
+// MarkTokens records the result of checking the destination's tokens
+// against the API. A nil err marks them valid for good.
+func (s *State) MarkTokens(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokensErr = err
+	if err == nil {
+		s.tokensOK = true
+	}
+}
+
+// TokensValid reports whether MarkTokens has recorded a successful check.
+func (s *State) TokensValid() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokensOK
+}
+
+// live reports whether the destination's worker is alive, with a reason when not.
+func (s *State) live(p HealthPolicy, now time.Time) (bool, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopped {
+		return false, "worker stopped"
+	}
+	if _, ok := s.stuck(p, now); ok {
+		return false, "run stuck past run_timeout"
+	}
+	return true, ""
+}
+
+// ready reports whether the destination has valid tokens and has finished a
+// run, with a reason when not. Paused destinations don't need to have run.
+func (s *State) ready(paused bool) (bool, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	switch {
+	case s.tokensErr != nil && !s.tokensOK:
+		// The error itself is logged; it may name the API URL.
+		return false, "token check failed"
+	case !s.tokensOK:
+		return false, "tokens not checked yet"
+	case s.runs == 0 && !paused:
+		return false, "waiting for first run"
+	}
+	return true, ""
+}
+
+// GET /livez — whether the process and every destination's worker are alive.
+// Public, like the /healthz summary, so orchestrators need no credentials.
+func (ms *MultiState) handleLivez(w http.ResponseWriter, _ *http.Request) {
+	now := time.Now()
+	ms.writeProbe(w, "live", func(name string) (bool, string) {
+		return ms.states[name].live(ms.policy, now)
+	})
+}
+
+// GET /readyz — whether every destination has valid tokens and a finished run.
+func (ms *MultiState) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	ms.writeProbe(w, "ready", func(name string) (bool, string) {
+		return ms.states[name].ready(ms.controls[name].Paused())
+	})
+}
+
+// writeProbe writes {key: bool, "destinations": {...}}, answering 503 unless
+// check passes for every destination.
+func (ms *MultiState) writeProbe(w http.ResponseWriter, key string, check func(name string) (bool, string)) {
+	all := true
+	dests := make(map[string]any, len(ms.names))
+	for _, name := range ms.names {
+		ok, reason := check(name)
+		entry := map[string]any{key: ok}
+		if reason != "" {
+			entry["reason"] = reason
+		}
+		dests[name] = entry
+		all = all && ok
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !all {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{key: all, "destinations": dests})
+}
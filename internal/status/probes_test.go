@@ -0,0 +1,81 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/syncer"
+)
+
+func probe(t *testing.T, h http.Handler, target string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, body
+}
+
+func TestReadyz(t *testing.T) {
+	ms := NewMultiState([]string{"a", "b"}, time.Minute)
+	ms.SetAuth(Auth{BearerToken: "secret"})
+	h := ms.Handler()
+
+	if code, body := probe(t, h, "/readyz"); code != http.StatusServiceUnavailable || body["ready"] != false {
+		t.Fatalf("before any check: %d %v", code, body)
+	}
+
+	ms.For("a").MarkTokens(errors.New("status=401"))
+	code, body := probe(t, h, "/readyz")
+	a := body["destinations"].(map[string]any)["a"].(map[string]any)
+	if code != http.StatusServiceUnavailable || a["reason"] != "token check failed" {
+		t.Fatalf("bad token: %d %v", code, body)
+	}
+
+	for _, n := range []string{"a", "b"} {
+		ms.For(n).MarkTokens(nil)
+	}
+	if code, _ := probe(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("no run yet: got %d", code)
+	}
+
+	ms.For("a").MarkResult(syncer.Stats{}, nil, false)
+	ms.For("b").MarkResult(syncer.Stats{}, errors.New("status=503"), false)
+	if code, body := probe(t, h, "/readyz"); code != http.StatusOK || body["ready"] != true {
+		t.Fatalf("after first runs: %d %v", code, body)
+	}
+}
+
+func TestLivez(t *testing.T) {
+	ms := NewMultiState([]string{"a"}, time.Minute)
+	ms.SetHealthPolicy(HealthPolicy{FailAfter: 3, FailingErrorRatio: 1, RunTimeout: time.Minute})
+	h := ms.Handler()
+
+	if code, body := probe(t, h, "/livez"); code != http.StatusOK || body["live"] != true {
+		t.Fatalf("idle: %d %v", code, body)
+	}
+
+	st := ms.For("a")
+	st.MarkStart()
+	st.mu.Lock()
+	st.lastRunAt = time.Now().Add(-time.Hour)
+	st.mu.Unlock()
+	if code, _ := probe(t, h, "/livez"); code != http.StatusServiceUnavailable {
+		t.Fatalf("stuck run: got %d", code)
+	}
+
+	st.MarkResult(syncer.Stats{}, nil, false)
+	if code, _ := probe(t, h, "/livez"); code != http.StatusOK {
+		t.Fatalf("run finished: got %d", code)
+	}
+	st.MarkStopped()
+	if code, _ := probe(t, h, "/livez"); code != http.StatusServiceUnavailable {
+		t.Fatalf("worker stopped: got %d", code)
+	}
+}
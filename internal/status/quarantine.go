@@ -0,0 +1,51 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"rdmirrorsync/internal/failures"
+)
+
+// SetFailures adds each destination's quarantined hashes to /healthz and
+// enables POST /admin/quarantine/clear, backed by store.
+func (ms *MultiState) SetFailures(store *failures.Store) {
+	ms.failures = store
+}
+
+// addQuarantine adds the destination's quarantined hashes to snap.
+func (ms *MultiState) addQuarantine(name string, snap map[string]any) {
+	if ms.failures == nil {
+		return
+	}
+	recs, err := ms.failures.Quarantined(name)
+	if err != nil {
+		snap["quarantine_error"] = err.Error()
+		return
+	}
+	snap["quarantined"] = recs
+}
+
+// POST /admin/quarantine/clear[?dest=x][&hash=h] — forget failed adds of
+// hash, or of every hash, so the next run tries them again.
+func (ms *MultiState) handleQuarantineClear(w http.ResponseWriter, r *http.Request) {
+	if ms.failures == nil {
+		writeError(w, http.StatusNotFound, "failure tracking not enabled")
+		return
+	}
+	names, ok := ms.adminTargets(w, r)
+	if !ok {
+		return
+	}
+	hash := r.URL.Query().Get("hash")
+	cleared := make(map[string]int, len(names))
+	for _, n := range names {
+		c, err := ms.failures.Clear(n, hash)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		cleared[n] = c
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"cleared": cleared})
+}
@@ -0,0 +1,51 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/failures"
+	"rdmirrorsync/internal/syncer"
+)
+
+func TestQuarantineListedAndCleared(t *testing.T) {
+	store := failures.NewStore(t.TempDir())
+	tr := failures.NewTracker(store, "a", failures.Policy{QuarantineAfter: 1})
+	if err := tr.AddFailed(syncer.PlanItem{Hash: "bad", Name: "Bad"}, errors.New("status=451")); err != nil {
+		t.Fatal(err)
+	}
+
+	ms := NewMultiState([]string{"a", "b"}, time.Minute)
+	ms.EnableAdmin("secret")
+	h := ms.Handler()
+	if rec := adminRequest(t, h, http.MethodPost, "/admin/quarantine/clear", "secret"); rec.Code != http.StatusNotFound {
+		t.Fatalf("failure tracking disabled: got %d", rec.Code)
+	}
+	ms.SetFailures(store)
+
+	_, snap := probe(t, h, "/healthz?dest=a")
+	q, _ := snap["quarantined"].([]any)
+	if len(q) != 1 || q[0].(map[string]any)["hash"] != "bad" {
+		t.Fatalf("quarantined in /healthz: %v", snap["quarantined"])
+	}
+
+	rec := adminRequest(t, h, http.MethodPost, "/admin/quarantine/clear?dest=a&hash=bad", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("clear: got %d: %s", rec.Code, rec.Body)
+	}
+	var out struct {
+		Cleared map[string]int `json:"cleared"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Cleared["a"] != 1 || len(out.Cleared) != 1 {
+		t.Fatalf("cleared: %+v", out.Cleared)
+	}
+	if recs, _ := store.List("a"); len(recs) != 0 {
+		t.Fatalf("records left after clear: %+v", recs)
+	}
+}
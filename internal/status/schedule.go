@@ -0,0 +1,25 @@
+package status
+
+import (
+	"time"
+
+	"rdmirrorsync/internal/schedule"
+)
+
+// SetSchedule records how the destination is scheduled, for /healthz. The
+// longest gap between runs replaces the MultiState interval when deciding
+// whether the destination has gone stale.
+func (s *State) SetSchedule(sched schedule.Schedule, quiet schedule.Windows, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule = sched.String()
+	s.quiet = quiet
+	s.gap = schedule.MaxGap(sched, now)
+}
+
+// SetNextRun records when the next scheduled run is due.
+func (s *State) SetNextRun(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextRunAt = t
+}
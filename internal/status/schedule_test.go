@@ -0,0 +1,43 @@
+package status
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"rdmirrorsync/internal/schedule"
+	"rdmirrorsync/internal/syncer"
+)
+
+func TestScheduleInHealthz(t *testing.T) {
+	ms := NewMultiState([]string{"a"}, time.Minute)
+	st := ms.For("a")
+	nightly, err := schedule.ParseCron("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quiet, _ := schedule.ParseWindows([]string{"18:00-23:00"})
+	st.SetSchedule(nightly, quiet, time.Now())
+	next := time.Now().Add(time.Hour).Truncate(time.Second)
+	st.SetNextRun(next)
+	st.MarkResult(syncer.Stats{}, nil, false)
+	// Five hours since the last success is stale for a one-minute interval,
+	// but not for a nightly schedule.
+	st.mu.Lock()
+	st.lastSuccessAt = time.Now().Add(-5 * time.Hour)
+	st.mu.Unlock()
+
+	code, body := probe(t, ms.Handler(), "/healthz?dest=a")
+	if code != http.StatusOK || body["health"] != HealthOK {
+		t.Fatalf("nightly schedule: %d %v", code, body)
+	}
+	if body["schedule"] != "cron 0 3 * * *" || body["next_run_at"] != next.Format(time.RFC3339) {
+		t.Fatalf("schedule fields: %v", body)
+	}
+	if q, ok := body["quiet_hours"].([]any); !ok || len(q) != 1 || q[0] != "18:00-23:00" {
+		t.Fatalf("quiet_hours: %v", body["quiet_hours"])
+	}
+	if _, ok := body["quiet"].(bool); !ok {
+		t.Fatalf("quiet missing: %v", body)
+	}
+}
@@ -2,11 +2,16 @@ package status
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"sync"
 	"time"
 
+	"rdmirrorsync/internal/approval"
+	"rdmirrorsync/internal/failures"
+	"rdmirrorsync/internal/lists"
+	"rdmirrorsync/internal/metrics"
+	"rdmirrorsync/internal/schedule"
 	"rdmirrorsync/internal/syncer"
 )
 
@@ -20,10 +25,30 @@ type State struct {
 	lastError     string
 	lastOK        bool
 	lastStats     syncer.Stats
+	failures      int // consecutive failed runs
+	runs          int // finished runs
+
+	schedule  string
+	quiet     schedule.Windows
+	gap       time.Duration // longest expected time between runs; 0 uses the MultiState interval
+	nextRunAt time.Time
+
+	stopped   bool  // the destination's worker goroutine has exited
+	tokensOK  bool  // both tokens were accepted by the API
+	tokensErr error // last token check failure
+
+	restarts  int // workers restarted after a panic
+	lastPanic *PanicRecord
+
+	lastPlan syncer.Plan
+	prevPlan syncer.Plan
+	hasPlan  bool
+
+	history history
 }
 
 func NewState() *State {
-	return &State{}
+	return &State{history: newHistory(DefaultHistorySize)}
 }
 
 func (s *State) MarkStart() {
@@ -33,128 +58,432 @@ func (s *State) MarkStart() {
 	s.lastRunAt = time.Now()
 }
 
-func (s *State) MarkResult(stats syncer.Stats, err error) {
+// MarkResult records a finished run. A cancelled run, stopped through
+// /admin/cancel or by shutdown, goes into the history but says nothing about
+// the destination's health, so it leaves the failure count alone.
+func (s *State) MarkResult(stats syncer.Stats, err error, cancelled bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	now := time.Now()
 	s.running = false
+	s.runs++
+	rec := RunRecord{
+		StartedAt:  s.lastRunAt,
+		FinishedAt: now,
+		Duration:   now.Sub(s.lastRunAt).Seconds(),
+		OK:         err == nil,
+		Cancelled:  cancelled && err != nil,
+		Stats:      stats,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	s.history.add(rec)
+	if rec.Cancelled {
+		return
+	}
 	s.lastStats = stats
 	if err != nil {
 		s.lastError = err.Error()
 		s.lastOK = false
+		s.failures++
 		return
 	}
 	s.lastError = ""
+	s.failures = 0
 	s.lastOK = true
-	s.lastSuccessAt = time.Now()
+	s.lastSuccessAt = now
+}
+
+// MarkPlan records the plan computed by the latest run, keeping the previous
+// one so /plan?diff=1 can show what changed between runs.
+func (s *State) MarkPlan(p syncer.Plan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prevPlan = s.lastPlan
+	s.lastPlan = p
+	s.hasPlan = true
+}
+
+// Plans returns the latest and previous plans, and whether any run has
+// produced a plan yet.
+func (s *State) Plans() (last, prev syncer.Plan, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastPlan, s.prevPlan, s.hasPlan
 }
 
-func (s *State) snapshot(interval time.Duration) map[string]any {
+func (s *State) snapshot(p HealthPolicy, interval time.Duration, paused bool) map[string]any {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	healthy := s.lastOK || s.running
-	if !s.lastSuccessAt.IsZero() && interval > 0 && time.Since(s.lastSuccessAt) > 2*interval {
-		healthy = false
+	now := time.Now()
+	level, reason := s.health(p, interval, paused, now)
+	snap := map[string]any{
+		"healthy":              level != HealthFailing,
+		"health":               level,
+		"reason":               reason,
+		"running":              s.running,
+		"last_run_at":          s.lastRunAt,
+		"last_success_at":      s.lastSuccessAt,
+		"last_error":           s.lastError,
+		"last_ok":              s.lastOK,
+		"last_stats":           s.lastStats,
+		"consecutive_failures": s.failures,
+		"next_run_at":          s.nextRunAt,
 	}
-	return map[string]any{
-		"healthy":         healthy,
-		"running":         s.running,
-		"last_run_at":     s.lastRunAt,
-		"last_success_at": s.lastSuccessAt,
-		"last_error":      s.lastError,
-		"last_ok":         s.lastOK,
-		"last_stats":      s.lastStats,
+	if s.schedule != "" {
+		snap["schedule"] = s.schedule
 	}
+	if s.lastPanic != nil {
+		snap["restarts"] = s.restarts
+		snap["last_panic"] = s.lastPanic
+	}
+	if len(s.quiet) > 0 {
+		snap["quiet_hours"] = s.quiet.Strings()
+		snap["quiet"] = s.quiet.Contains(now)
+	}
+	return snap
 }
 
 // MultiState tracks run history for all destinations and serves /healthz and /metrics.
 type MultiState struct {
-	interval time.Duration
-	names    []string // ordered for stable output
-	states   map[string]*State
+	interval  time.Duration
+	policy    HealthPolicy
+	names     []string // ordered for stable output
+	states    map[string]*State
+	controls  map[string]*Control
+	approvals *approval.Store
+	failures  *failures.Store
+	lists     *lists.Store
+	auditPath string
+
+	auth       Auth
+	adminToken string
+	registry   *metrics.Registry
 }
 
 // NewMultiState creates a MultiState for the given destination names.
 func NewMultiState(names []string, interval time.Duration) *MultiState {
 	ms := &MultiState{
 		interval: interval,
+		policy:   DefaultHealthPolicy(),
 		names:    names,
 		states:   make(map[string]*State, len(names)),
+		controls: make(map[string]*Control, len(names)),
+		registry: metrics.NewRegistry(),
 	}
 	for _, n := range names {
 		ms.states[n] = NewState()
+		ms.controls[n] = NewControl(false)
 	}
+	ms.registerGauges()
 	return ms
 }
 
+// Registry returns the registry served on /metrics, so callers can add
+// their own metrics to it.
+func (ms *MultiState) Registry() *metrics.Registry {
+	return ms.registry
+}
+
+// registerGauges exposes the per-destination state of the last run as gauges.
+func (ms *MultiState) registerGauges() {
+	gauge := func(name, help string, value func(s *State, c *Control) float64) {
+		ms.registry.NewGaugeFunc(name, help, []string{"dest"}, func(emit func(float64, ...string)) {
+			for _, n := range ms.names {
+				st := ms.states[n]
+				st.mu.RLock()
+				v := value(st, ms.controls[n])
+				st.mu.RUnlock()
+				emit(v, n)
+			}
+		})
+	}
+	gauge("rd_mirror_health", "Destination health: 0 ok, 1 degraded, 2 failing.",
+		func(s *State, c *Control) float64 {
+			level, _ := s.health(ms.policy, ms.interval, c.Paused(), time.Now())
+			return float64(healthRank(level))
+		})
+	gauge("rd_mirror_running", "Whether a run is in progress.",
+		func(s *State, _ *Control) float64 { return boolToFloat(s.running) })
+	gauge("rd_mirror_paused", "Whether the destination is paused via the admin API.",
+		func(_ *State, c *Control) float64 { return boolToFloat(c.Paused()) })
+	gauge("rd_mirror_last_run_ok", "Whether the last run succeeded.",
+		func(s *State, _ *Control) float64 { return boolToFloat(s.lastOK) })
+	gauge("rd_mirror_last_run_timestamp_seconds", "Unix time the last run started; 0 before the first run.",
+		func(s *State, _ *Control) float64 { return unixSeconds(s.lastRunAt) })
+	gauge("rd_mirror_last_success_timestamp_seconds", "Unix time of the last successful run; 0 if none.",
+		func(s *State, _ *Control) float64 { return unixSeconds(s.lastSuccessAt) })
+	gauge("rd_mirror_last_need_add", "Torrents the last run needed to add.",
+		func(s *State, _ *Control) float64 { return float64(s.lastStats.NeedAdd) })
+	gauge("rd_mirror_last_need_delete", "Torrents the last run needed to delete.",
+		func(s *State, _ *Control) float64 { return float64(s.lastStats.NeedDelete) })
+	gauge("rd_mirror_last_added", "Torrents added by the last run.",
+		func(s *State, _ *Control) float64 { return float64(s.lastStats.Added) })
+	gauge("rd_mirror_last_deleted", "Torrents deleted by the last run.",
+		func(s *State, _ *Control) float64 { return float64(s.lastStats.Deleted) })
+	gauge("rd_mirror_last_add_errors", "Add errors in the last run.",
+		func(s *State, _ *Control) float64 { return float64(s.lastStats.AddErrors) })
+	gauge("rd_mirror_last_delete_errors", "Delete errors in the last run.",
+		func(s *State, _ *Control) float64 { return float64(s.lastStats.DeleteErrors) })
+	gauge("rd_mirror_awaiting_approval", "Deletes held back by the last run pending approval.",
+		func(s *State, _ *Control) float64 { return float64(s.lastStats.AwaitingApproval) })
+	gauge("rd_mirror_quarantined", "Source torrents the last run did not add because they are quarantined.",
+		func(s *State, _ *Control) float64 { return float64(s.lastStats.Quarantined) })
+}
+
+// SetApprovals enables the /approvals endpoints backed by store.
+func (ms *MultiState) SetApprovals(store *approval.Store) {
+	ms.approvals = store
+}
+
 // For returns the State for the given destination name.
 func (ms *MultiState) For(name string) *State {
 	return ms.states[name]
 }
 
-// Handler returns an http.Handler for /healthz and /metrics.
+// Control returns the runtime Control for the given destination name.
+func (ms *MultiState) Control(name string) *Control {
+	return ms.controls[name]
+}
+
+// Health returns a destination's health level and the reason it is not ok,
+// as /healthz reports them.
+func (ms *MultiState) Health(name string) (level, reason string) {
+	s := ms.states[name]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.health(ms.policy, ms.interval, ms.controls[name].Paused(), time.Now())
+}
+
+// snapshot returns a destination's /healthz entry, including its controls.
+func (ms *MultiState) snapshot(name string) map[string]any {
+	c := ms.controls[name]
+	snap := ms.states[name].snapshot(ms.policy, ms.interval, c.Paused())
+	snap["paused"] = c.Paused()
+	snap["dry_run"] = c.DryRun()
+	ms.addQuarantine(name, snap)
+	return snap
+}
+
+// Handler returns an http.Handler for /healthz, /plan and /metrics.
 //
-// GET /healthz         — all destinations; overall healthy = all healthy
+// GET /healthz         — all destinations; overall health is the worst destination's; 503 when "failing"
 // GET /healthz?dest=x  — single destination (same shape as overall, no "destinations" wrapper)
+// GET /plan            — latest plan for every destination (JSON array)
+// GET /plan?dest=x     — latest plan for one destination
+// GET /plan?format=csv — CSV instead of JSON (combines with dest)
+// GET /plan?dest=x&diff=1 — rows that changed since the previous run's plan
+// GET /approvals[?dest=x]  — delete plans awaiting or holding approval
+// GET /history[?dest=x][&limit=n] — recent runs, newest first
+// GET /lists[?dest=x]  — ignore and pin lists
+// GET /livez           — 200 while every destination's worker is alive and not stuck, else 503
+// GET /readyz          — 200 once every destination's tokens are valid and its first run finished, else 503
+// GET /audit[?dest=x][&hash=h][&action=a][&limit=n] — recent audit log entries, newest first
+// GET /ui/             — HTML dashboard (GET / redirects here)
+//
+// With SetAuth, every GET endpoint except /healthz, /livez, /readyz and the
+// dashboard's static files requires credentials, and /healthz only returns a summary to
+// unauthenticated clients.
+//
+// With EnableAdmin, these POST endpoints require "Authorization: Bearer <token>":
+//
+// POST /approvals/approve?id=ID — approve a pending delete plan
+// POST /admin/run[?dest=x]      — queue an immediate run
+// POST /admin/pause[?dest=x]    — pause scheduled and triggered runs
+// POST /admin/resume[?dest=x]   — resume
+// POST /admin/dry-run?enabled=true|false[&dest=x] — toggle dry_run from the next run
+// POST /admin/cancel[?dest=x]   — cancel the in-progress run
+// POST /admin/quarantine/clear[?dest=x][&hash=h] — retry quarantined or backed-off adds
+// POST /admin/lists/add?dest=x&list=ignore|pin&hash=h[&note=text] — never add or never delete hash
+// POST /admin/lists/remove?dest=x&list=ignore|pin&hash=h
 func (ms *MultiState) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		detailed := ms.auth.authorized(r)
+		view := func(name string) map[string]any {
+			snap := ms.snapshot(name)
+			if !detailed {
+				return publicSnapshot(snap)
+			}
+			return snap
+		}
 
 		dest := r.URL.Query().Get("dest")
 		if dest != "" {
-			st, ok := ms.states[dest]
-			if !ok {
-				w.WriteHeader(http.StatusNotFound)
-				_ = json.NewEncoder(w).Encode(map[string]string{"error": "unknown destination"})
+			if _, ok := ms.states[dest]; !ok {
+				writeError(w, http.StatusNotFound, "unknown destination")
 				return
 			}
-			_ = json.NewEncoder(w).Encode(st.snapshot(ms.interval))
+			snap := view(dest)
+			level, _ := snap["health"].(string)
+			w.WriteHeader(healthStatusCode(level))
+			_ = json.NewEncoder(w).Encode(snap)
 			return
 		}
 
 		// All destinations.
-		allHealthy := true
+		overall := HealthOK
 		dests := make(map[string]any, len(ms.names))
 		for _, name := range ms.names {
-			snap := ms.states[name].snapshot(ms.interval)
+			snap := view(name)
 			dests[name] = snap
-			if h, _ := snap["healthy"].(bool); !h {
-				allHealthy = false
-			}
+			level, _ := snap["health"].(string)
+			overall = worseHealth(overall, level)
 		}
+		w.WriteHeader(healthStatusCode(overall))
 		_ = json.NewEncoder(w).Encode(map[string]any{
-			"healthy":      allHealthy,
+			"healthy":      overall != HealthFailing,
+			"health":       overall,
 			"destinations": dests,
 		})
 	})
 
-	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
-		for _, name := range ms.names {
-			st := ms.states[name]
-			st.mu.RLock()
-			fmt.Fprintf(w, "rd_mirror_running{dest=%q} %d\n", name, boolToInt(st.running))
-			fmt.Fprintf(w, "rd_mirror_last_run_ok{dest=%q} %d\n", name, boolToInt(st.lastOK))
-			fmt.Fprintf(w, "rd_mirror_last_run_timestamp_seconds{dest=%q} %d\n", name, st.lastRunAt.Unix())
-			fmt.Fprintf(w, "rd_mirror_last_success_timestamp_seconds{dest=%q} %d\n", name, st.lastSuccessAt.Unix())
-			fmt.Fprintf(w, "rd_mirror_last_need_add{dest=%q} %d\n", name, st.lastStats.NeedAdd)
-			fmt.Fprintf(w, "rd_mirror_last_need_delete{dest=%q} %d\n", name, st.lastStats.NeedDelete)
-			fmt.Fprintf(w, "rd_mirror_last_added{dest=%q} %d\n", name, st.lastStats.Added)
-			fmt.Fprintf(w, "rd_mirror_last_deleted{dest=%q} %d\n", name, st.lastStats.Deleted)
-			fmt.Fprintf(w, "rd_mirror_last_add_errors{dest=%q} %d\n", name, st.lastStats.AddErrors)
-			fmt.Fprintf(w, "rd_mirror_last_delete_errors{dest=%q} %d\n", name, st.lastStats.DeleteErrors)
-			st.mu.RUnlock()
-		}
-	})
+	mux.HandleFunc("/livez", ms.handleLivez)
+	mux.HandleFunc("/readyz", ms.handleReadyz)
+	mux.HandleFunc("/plan", ms.protected(ms.handlePlan))
+	mux.HandleFunc("/approvals", ms.protected(ms.handleApprovals))
+	mux.HandleFunc("/history", ms.protected(ms.handleHistory))
+	mux.HandleFunc("/lists", ms.protected(ms.handleLists))
+	mux.HandleFunc("/audit", ms.protected(ms.handleAudit))
+	mux.HandleFunc("/", handleRoot)
+	mux.Handle("/ui/", uiHandler())
+	mux.HandleFunc("/ui/meta", ms.handleUIMeta)
+	mux.HandleFunc("/approvals/approve", ms.adminOnly(ms.handleApprove))
+	mux.HandleFunc("/admin/run", ms.adminOnly(ms.handleAdminRun))
+	mux.HandleFunc("/admin/pause", ms.adminOnly(ms.handleAdminPause(true)))
+	mux.HandleFunc("/admin/resume", ms.adminOnly(ms.handleAdminPause(false)))
+	mux.HandleFunc("/admin/dry-run", ms.adminOnly(ms.handleAdminDryRun))
+	mux.HandleFunc("/admin/cancel", ms.adminOnly(ms.handleAdminCancel))
+	mux.HandleFunc("/admin/quarantine/clear", ms.adminOnly(ms.handleQuarantineClear))
+	mux.HandleFunc("/admin/lists/add", ms.adminOnly(ms.handleListEdit(true)))
+	mux.HandleFunc("/admin/lists/remove", ms.adminOnly(ms.handleListEdit(false)))
+
+	mux.HandleFunc("/metrics", ms.protected(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", metrics.ContentType)
+		_ = ms.registry.WriteText(w)
+	}))
 
 	return mux
 }
 
-func boolToInt(v bool) int {
+func (ms *MultiState) handlePlan(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dest := q.Get("dest")
+	csvOut := q.Get("format") == "csv"
+
+	names := ms.names
+	if dest != "" {
+		if _, ok := ms.states[dest]; !ok {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, http.StatusNotFound, "unknown destination")
+			return
+		}
+		names = []string{dest}
+	}
+
+	if q.Get("diff") != "" {
+		if dest == "" {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, http.StatusBadRequest, "diff requires dest")
+			return
+		}
+		last, prev, _ := ms.states[dest].Plans()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(syncer.DiffPlans(prev, last))
+		return
+	}
+
+	plans := make([]syncer.Plan, 0, len(names))
+	for _, name := range names {
+		if last, _, ok := ms.states[name].Plans(); ok {
+			plans = append(plans, last)
+		}
+	}
+
+	if csvOut {
+		w.Header().Set("Content-Type", "text/csv")
+		_ = syncer.WritePlansCSV(w, plans)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if dest != "" {
+		if len(plans) == 0 {
+			writeError(w, http.StatusNotFound, "no plan yet")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(plans[0])
+		return
+	}
+	_ = json.NewEncoder(w).Encode(plans)
+}
+
+func (ms *MultiState) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if ms.approvals == nil {
+		writeError(w, http.StatusNotFound, "approvals not enabled")
+		return
+	}
+	recs, err := ms.approvals.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if dest := r.URL.Query().Get("dest"); dest != "" {
+		filtered := recs[:0]
+		for _, rec := range recs {
+			if rec.Dest == dest {
+				filtered = append(filtered, rec)
+			}
+		}
+		recs = filtered
+	}
+	_ = json.NewEncoder(w).Encode(recs)
+}
+
+func (ms *MultiState) handleApprove(w http.ResponseWriter, r *http.Request) {
+	if ms.approvals == nil {
+		writeError(w, http.StatusNotFound, "approvals not enabled")
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+	rec, err := ms.approvals.Approve(id)
+	switch {
+	case errors.Is(err, approval.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, approval.ErrApplied):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	_ = json.NewEncoder(w).Encode(rec)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+func boolToFloat(v bool) float64 {
 	if v {
 		return 1
 	}
 	return 0
 }
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.Unix())
+}
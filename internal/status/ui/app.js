@@ -0,0 +1,279 @@
+// rd-mirror-sync dashboard. Everything is read from the JSON endpoints of the
+// health server; admin buttons post to /admin with the admin token.
+"use strict";
+
+const REFRESH_MS = 15000;
+const tokens = {
+  read: sessionStorage.getItem("rdms.read") || "",
+  admin: sessionStorage.getItem("rdms.admin") || "",
+};
+let meta = null;
+
+const $ = (sel) => document.querySelector(sel);
+
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs || {})) {
+    if (k === "class") e.className = v;
+    else if (k.startsWith("on")) e.addEventListener(k.slice(2), v);
+    else if (v != null) e.setAttribute(k, v);
+  }
+  for (const c of children) {
+    if (c == null) continue;
+    e.append(c instanceof Node ? c : String(c));
+  }
+  return e;
+}
+
+function fmtTime(s) {
+  if (!s || s.startsWith("0001-")) return "never";
+  return new Date(s).toLocaleString();
+}
+
+function fmtDuration(secs) {
+  if (secs < 1) return Math.round(secs * 1000) + "ms";
+  if (secs < 60) return secs.toFixed(1) + "s";
+  return Math.floor(secs / 60) + "m" + Math.round(secs % 60) + "s";
+}
+
+function showError(msg) {
+  const p = $("#error");
+  p.textContent = msg || "";
+  p.hidden = !msg;
+}
+
+async function get(path) {
+  const headers = {};
+  if (tokens.read) headers.Authorization = "Bearer " + tokens.read;
+  const resp = await fetch(path, { headers });
+  if (resp.status === 401) throw new Error("Unauthorized: enter the health token.");
+  if (!resp.ok) {
+    const body = await resp.json().catch(() => ({}));
+    throw new Error(path + ": " + (body.error || resp.status));
+  }
+  return resp.json();
+}
+
+async function post(path) {
+  const resp = await fetch(path, {
+    method: "POST",
+    headers: { Authorization: "Bearer " + tokens.admin },
+  });
+  const body = await resp.json().catch(() => ({}));
+  if (resp.status === 401) throw new Error("Unauthorized: enter the admin token.");
+  if (!resp.ok && resp.status !== 409) throw new Error(path + ": " + (body.error || resp.status));
+  return body;
+}
+
+function fill(tbody, rows, empty, cols) {
+  tbody.replaceChildren();
+  if (rows.length === 0) {
+    tbody.append(el("tr", {}, el("td", { colspan: cols, class: "muted" }, empty)));
+    return;
+  }
+  tbody.append(...rows);
+}
+
+function statusBadge(snap) {
+  if (snap.running) return el("span", { class: "badge running" }, "running");
+  if (snap.paused) return el("span", { class: "badge paused" }, "paused");
+  const cls = { ok: "ok", degraded: "degraded", failing: "bad" }[snap.health] || "muted";
+  return el("span", { class: "badge " + cls, title: snap.reason || "" }, snap.health || "unknown");
+}
+
+async function adminAction(path) {
+  try {
+    const body = await post(path);
+    await refresh();
+    const results = Object.entries(body.results || {}).map(([d, r]) => d + ": " + r);
+    if (body.error || results.some((r) => r.endsWith("paused") || r.endsWith("not_running"))) {
+      showError(body.error || results.join(", "));
+    }
+  } catch (err) {
+    showError(err.message);
+  }
+}
+
+function adminButtons(name, snap) {
+  const q = "?dest=" + encodeURIComponent(name);
+  return el("td", { class: "actions" },
+    el("button", { onclick: () => adminAction("/admin/run" + q), disabled: snap.paused ? "" : null }, "Run now"),
+    snap.paused
+      ? el("button", { onclick: () => adminAction("/admin/resume" + q) }, "Resume")
+      : el("button", { onclick: () => adminAction("/admin/pause" + q) }, "Pause"),
+    snap.running ? el("button", { onclick: () => adminAction("/admin/cancel" + q) }, "Cancel") : null);
+}
+
+async function renderOverview() {
+  const admin = meta.admin_enabled;
+  document.querySelectorAll("th.admin").forEach((th) => (th.hidden = !admin));
+
+  const [health, plans, history] = await Promise.all([get("/healthz"), get("/plan"), get("/history?limit=10")]);
+  const planByDest = Object.fromEntries(plans.map((p) => [p.dest, p]));
+
+  const overall = $("#overall");
+  overall.textContent = health.health;
+  overall.className = "badge " + ({ ok: "ok", degraded: "degraded" }[health.health] || "bad");
+
+  const rows = meta.destinations.map((name) => {
+    const snap = health.destinations[name] || {};
+    const stats = snap.last_stats || {};
+    const plan = planByDest[name];
+    const tr = el("tr", {},
+      el("td", {}, el("a", { href: "#dest=" + encodeURIComponent(name) }, name)),
+      el("td", {}, statusBadge(snap), snap.dry_run ? el("span", { class: "badge muted" }, "dry run") : null),
+      el("td", {}, fmtTime(snap.last_run_at)),
+      el("td", { title: snap.schedule || "" }, fmtTime(snap.next_run_at), snap.quiet ? el("span", { class: "badge muted" }, "quiet") : null),
+      el("td", {}, fmtTime(snap.last_success_at)),
+      el("td", { class: "num" }, stats.source_count ?? ""),
+      el("td", { class: "num" }, stats.dest_count ?? ""),
+      el("td", { class: "num" }, plan ? plan.adds.length : ""),
+      el("td", { class: "num" }, plan ? plan.deletes.length : ""),
+      el("td", { class: "num" }, stats.awaiting_approval || ""),
+      el("td", { class: "error" }, snap.last_error || snap.reason || ""));
+    if (admin) tr.append(adminButtons(name, snap));
+    return tr;
+  });
+  fill($("#destinations tbody"), rows, "No destinations.", admin ? 12 : 11);
+
+  const runs = [];
+  for (const [name, list] of Object.entries(history.destinations)) {
+    for (const r of list) runs.push({ dest: name, ...r });
+  }
+  runs.sort((a, b) => new Date(b.started_at) - new Date(a.started_at));
+  fill($("#runs tbody"), runs.slice(0, 20).map((r) =>
+    el("tr", { class: r.ok ? "" : "failed" },
+      el("td", {}, r.dest),
+      el("td", {}, fmtTime(r.started_at)),
+      el("td", { class: "num" }, fmtDuration(r.duration_seconds)),
+      el("td", {}, r.ok ? "ok" : r.error),
+      el("td", { class: "num" }, r.stats.added),
+      el("td", { class: "num" }, r.stats.deleted),
+      el("td", { class: "num" }, r.stats.add_errors + r.stats.delete_errors))),
+  "No runs yet.", 7);
+
+  if (meta.approvals) {
+    const recs = await get("/approvals");
+    $("#approvals-section").hidden = false;
+    fill($("#approvals tbody"), recs.map((a) =>
+      el("tr", {},
+        el("td", { class: "mono" }, a.id),
+        el("td", {}, a.dest),
+        el("td", { class: "num" }, a.deletes.length),
+        el("td", {}, fmtTime(a.created_at)),
+        el("td", {}, a.status))),
+    "Nothing awaiting approval.", 5);
+  }
+
+  if (meta.audit_enabled) {
+    $("#audit-section").hidden = false;
+    let events = await get("/audit?limit=100");
+    if ($("#audit-errors").checked) events = events.filter((e) => e.error);
+    fill($("#audit tbody"), events.slice(0, 50).map((e) =>
+      el("tr", { class: e.error ? "failed" : "" },
+        el("td", {}, fmtTime(e.time)),
+        el("td", {}, e.dest),
+        el("td", {}, e.action),
+        el("td", {}, e.name),
+        el("td", { class: "mono" }, e.hash),
+        el("td", {}, e.reason),
+        el("td", { class: "error" }, e.error || ""))),
+    "No changes recorded.", 7);
+  }
+}
+
+function itemRows(items, idField) {
+  return items.map(({ action, item }) =>
+    el("tr", { class: "action-" + action },
+      el("td", {}, item.name),
+      el("td", { class: "mono" }, item.hash),
+      el("td", { class: "mono" }, item[idField] || ""),
+      el("td", {}, action),
+      el("td", {}, item.reason)));
+}
+
+async function renderDetail(name) {
+  $("#detail-title").textContent = name;
+  const q = "?dest=" + encodeURIComponent(name);
+  let plan;
+  try {
+    plan = await get("/plan" + q);
+  } catch (err) {
+    if (!err.message.endsWith("no plan yet")) throw err;
+    $("#detail-summary").textContent = "No plan yet; the destination has not finished a run.";
+    for (const id of ["#plan-diff", "#only-source", "#only-dest"]) $(id + " tbody").replaceChildren();
+    return;
+  }
+  const health = await get("/healthz" + q);
+  const stats = health.last_stats || {};
+  const inBoth = (stats.source_count || 0) - (stats.skipped_bad_src || 0) - plan.adds.length;
+  $("#detail-summary").textContent =
+    `Plan from ${fmtTime(plan.created_at)} (${plan.mode}${plan.dry_run ? ", dry run" : ""}): ` +
+    `${stats.source_count ?? "?"} in source, ${stats.dest_count ?? "?"} on destination, ${inBoth} in both.`;
+
+  const tag = (action) => (item) => ({ action, item });
+  const srcOnly = [
+    ...plan.adds.map(tag("add")),
+    ...plan.skipped.filter((i) => i.source_id && !i.dest_id).map(tag("skipped")),
+  ];
+  const dstOnly = [
+    ...plan.deletes.map(tag("delete")),
+    ...plan.protected.map(tag("protected")),
+    ...plan.skipped.filter((i) => i.dest_id).map(tag("skipped")),
+  ];
+  fill($("#only-source tbody"), itemRows(srcOnly, "source_id"), "Nothing missing on the destination.", 5);
+  fill($("#only-dest tbody"), itemRows(dstOnly, "dest_id"), "Nothing extra on the destination.", 5);
+
+  const diff = await get("/plan" + q + "&diff=1");
+  const changed = [
+    ...diff.new.map((r) => ({ sign: "+", r })),
+    ...diff.gone.map((r) => ({ sign: "−", r })),
+  ];
+  fill($("#plan-diff tbody"), changed.map(({ sign, r }) =>
+    el("tr", { class: sign === "+" ? "new" : "gone" },
+      el("td", {}, sign),
+      el("td", {}, r.action),
+      el("td", {}, r.name),
+      el("td", { class: "mono" }, r.hash),
+      el("td", {}, r.reason))),
+  "No change.", 5);
+}
+
+function route() {
+  const m = location.hash.match(/^#dest=(.+)$/);
+  return m ? decodeURIComponent(m[1]) : null;
+}
+
+async function refresh() {
+  try {
+    if (!meta) meta = await get("/ui/meta");
+    $("#read-token-field").hidden = !meta.bearer_auth;
+    $("#admin-token-field").hidden = !meta.admin_enabled;
+    const dest = route();
+    $("#overview").hidden = dest !== null;
+    $("#detail").hidden = dest === null;
+    if (dest === null) await renderOverview();
+    else await renderDetail(dest);
+    showError("");
+  } catch (err) {
+    showError(err.message);
+  }
+}
+
+$("#tokens").addEventListener("submit", (ev) => {
+  ev.preventDefault();
+  const form = ev.target;
+  tokens.read = form.read.value;
+  tokens.admin = form.admin.value;
+  sessionStorage.setItem("rdms.read", tokens.read);
+  sessionStorage.setItem("rdms.admin", tokens.admin);
+  refresh();
+});
+$("#tokens").read.value = tokens.read;
+$("#tokens").admin.value = tokens.admin;
+$("#audit-errors").addEventListener("change", refresh);
+window.addEventListener("hashchange", refresh);
+$("#refresh-secs").textContent = REFRESH_MS / 1000;
+
+refresh();
+setInterval(refresh, REFRESH_MS);
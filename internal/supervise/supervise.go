@@ -0,0 +1,73 @@
+// Package supervise keeps a long-running worker going: a panic is recovered
+// and the worker restarted after a backoff, so one destination's bug does
+// not take down the others.
+package supervise
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+)
+
+// Policy sets how soon a panicked worker restarts.
+type Policy struct {
+	// MinBackoff is the wait before the first restart; it doubles with each
+	// consecutive panic up to MaxBackoff. A worker that ran longer than
+	// MaxBackoff before panicking starts again from MinBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Panic describes a recovered panic.
+type Panic struct {
+	Value    any
+	Stack    []byte
+	Restarts int           // restarts so far, including the coming one
+	Wait     time.Duration // delay before the restart
+	// Final is set when ctx was already done, so fn is not restarted;
+	// Restarts then excludes this panic and Wait is zero.
+	Final bool
+}
+
+// Run calls fn until it returns normally or ctx is done. fn is told how many
+// times it has been restarted. After a panic, onPanic is called and fn runs
+// again once the backoff has passed. A panic recovered after ctx is done is
+// still passed to onPanic, with Final set, before Run returns.
+func Run(ctx context.Context, p Policy, fn func(ctx context.Context, restarts int), onPanic func(Panic)) {
+	backoff := p.MinBackoff
+	for restarts := 0; ; {
+		started := time.Now()
+		v, stack, panicked := call(ctx, fn, restarts)
+		if !panicked {
+			return
+		}
+		if ctx.Err() != nil {
+			onPanic(Panic{Value: v, Stack: stack, Restarts: restarts, Final: true})
+			return
+		}
+		if time.Since(started) > p.MaxBackoff {
+			backoff = p.MinBackoff
+		}
+		restarts++
+		onPanic(Panic{Value: v, Stack: stack, Restarts: restarts, Wait: backoff})
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		backoff = min(2*backoff, p.MaxBackoff)
+	}
+}
+
+func call(ctx context.Context, fn func(context.Context, int), restarts int) (v any, stack []byte, panicked bool) {
+	defer func() {
+		if v = recover(); v != nil {
+			stack, panicked = debug.Stack(), true
+		}
+	}()
+	fn(ctx, restarts)
+	return nil, nil, false
+}
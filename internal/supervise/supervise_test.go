@@ -0,0 +1,69 @@
+package supervise
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunRestartsAfterPanic(t *testing.T) {
+	var calls []int
+	var panics []Panic
+	Run(context.Background(), Policy{MinBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond},
+		func(_ context.Context, restarts int) {
+			calls = append(calls, restarts)
+			if restarts < 3 {
+				var m map[string]int
+				m["boom"]++ // nil map write
+			}
+		},
+		func(p Panic) { panics = append(panics, p) })
+
+	if len(calls) != 4 || calls[3] != 3 {
+		t.Fatalf("calls: %v", calls)
+	}
+	if len(panics) != 3 {
+		t.Fatalf("panics: %d", len(panics))
+	}
+	for i, want := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond} {
+		if panics[i].Wait != want || panics[i].Restarts != i+1 {
+			t.Errorf("panic %d: wait %s restarts %d", i, panics[i].Wait, panics[i].Restarts)
+		}
+	}
+	if !strings.Contains(string(panics[0].Stack), "supervise_test.go") {
+		t.Errorf("stack does not point at the panic:\n%s", panics[0].Stack)
+	}
+}
+
+func TestRunStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, Policy{MinBackoff: time.Hour, MaxBackoff: time.Hour},
+			func(context.Context, int) { calls++; panic("boom") },
+			func(Panic) { cancel() })
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after ctx was cancelled during backoff")
+	}
+	if calls != 1 {
+		t.Fatalf("calls: %d", calls)
+	}
+}
+
+func TestRunReportsPanicAfterContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var panics []Panic
+	Run(ctx, Policy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		func(context.Context, int) { cancel(); panic("boom") },
+		func(p Panic) { panics = append(panics, p) })
+
+	if len(panics) != 1 || !panics[0].Final || panics[0].Value != "boom" || panics[0].Restarts != 0 {
+		t.Fatalf("panics: %+v", panics)
+	}
+}
@@ -0,0 +1,143 @@
+package syncer
+
+import (
+	"slices"
+	"time"
+
+	"rdmirrorsync/internal/logging"
+	"rdmirrorsync/internal/rdapi"
+)
+
+// destModel is the runner's picture of the destination library: what the
+// last full listing returned, updated with the runner's own adds and
+// deletes since. It lets a run plan without listing the destination again.
+// Changes made to the destination by anyone else go unnoticed until the
+// next full listing, which happens every FullReconcile or as soon as an
+// add or delete has an outcome the model cannot be sure of.
+type destModel struct {
+	byHash   map[string]dstEntry   // the copy kept of each hash
+	dupes    map[string][]dstEntry // further copies of hashes held more than once
+	count    int                   // torrents on the destination, including any without a hash
+	listedAt time.Time
+}
+
+func newDestModel(listedAt time.Time) *destModel {
+	return &destModel{byHash: make(map[string]dstEntry), dupes: make(map[string][]dstEntry), listedAt: listedAt}
+}
+
+// listed records a torrent from a listing. When the hash was already seen
+// the better copy is kept and the other becomes a duplicate.
+func (m *destModel) listed(hash string, e dstEntry) {
+	kept, ok := m.byHash[hash]
+	switch {
+	case !ok:
+		m.byHash[hash] = e
+	case e.better(kept):
+		m.byHash[hash] = e
+		m.dupes[hash] = append(m.dupes[hash], kept)
+	default:
+		m.dupes[hash] = append(m.dupes[hash], e)
+	}
+}
+
+// duplicates returns how many copies beyond the first the destination holds.
+func (m *destModel) duplicates() int {
+	n := 0
+	for _, d := range m.dupes {
+		n += len(d)
+	}
+	return n
+}
+
+// put records a torrent the runner added, or one whose status it changed.
+// Like remove, it does nothing on a nil model.
+func (m *destModel) put(hash string, e dstEntry) {
+	if m == nil {
+		return
+	}
+	if _, ok := m.byHash[hash]; !ok {
+		m.count++
+	}
+	m.byHash[hash] = e
+}
+
+// remove forgets the copy of hash with torrent id id after the runner
+// deleted it. If that was the kept copy, the best duplicate takes its place.
+func (m *destModel) remove(hash, id string) {
+	if m == nil {
+		return
+	}
+	dupes := m.dupes[hash]
+	kept, ok := m.byHash[hash]
+	switch {
+	case ok && kept.id == id && len(dupes) == 0:
+		delete(m.byHash, hash)
+	case ok && kept.id == id:
+		best := 0
+		for i := range dupes {
+			if dupes[i].better(dupes[best]) {
+				best = i
+			}
+		}
+		m.byHash[hash] = dupes[best]
+		dupes = append(dupes[:best], dupes[best+1:]...)
+	default:
+		i := slices.IndexFunc(dupes, func(e dstEntry) bool { return e.id == id })
+		if i < 0 {
+			return
+		}
+		dupes = append(dupes[:i], dupes[i+1:]...)
+	}
+	m.count--
+	if len(dupes) == 0 {
+		delete(m.dupes, hash)
+	} else {
+		m.dupes[hash] = dupes
+	}
+}
+
+// better reports whether e is a healthier copy of a torrent than o, or an
+// older one when both are as healthy.
+func (e dstEntry) better(o dstEntry) bool {
+	if he, ho := health(e.status), health(o.status); he != ho {
+		return he > ho
+	}
+	if e.added != o.added {
+		return e.added != "" && (o.added == "" || e.added < o.added)
+	}
+	return e.id < o.id
+}
+
+// health ranks a torrent status: ready, then still downloading, then
+// waiting for file selection, then failed or unknown.
+func health(status string) int {
+	switch status {
+	case rdapi.StatusDownloaded:
+		return 3
+	case "downloading", "queued", "compressing", "uploading":
+		return 2
+	case rdapi.StatusWaitingFiles, rdapi.StatusMagnetConversion:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// cachedDest returns the destination model if it may be planned from at
+// now, or nil when the destination has to be listed.
+func (r *Runner) cachedDest(now time.Time) *destModel {
+	if r.dst == nil || r.cfg.FullReconcile <= 0 || now.Sub(r.dst.listedAt) >= r.cfg.FullReconcile {
+		return nil
+	}
+	return r.dst
+}
+
+// distrustDest drops the destination model so the next run lists the
+// destination in full.
+func (r *Runner) distrustDest(why string) {
+	if r.dst == nil {
+		return
+	}
+	r.dst = nil
+	r.log.Debug("destination model dropped; next run lists the destination", logging.KeyOp, "sync", "reason", why)
+}
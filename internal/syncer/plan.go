@@ -0,0 +1,233 @@
+package syncer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"rdmirrorsync/internal/rdapi"
+)
+
+// Reasons attached to plan items.
+const (
+	ReasonMissingOnDest   = "missing_on_destination"
+	ReasonNotInSource     = "not_in_source"
+	ReasonProtectRegex    = "protect_dst_regex"
+	ReasonAddOnlyMode     = "add_only_mode"
+	ReasonEmptySourceHash = "empty_source_hash"
+	ReasonFailureBackoff  = "failure_backoff"
+	ReasonQuarantined     = "quarantined"
+	ReasonIgnored         = "ignored"
+	ReasonPinned          = "pinned"
+	// ReasonIncompleteListing holds back a delete because a listing may
+	// have missed torrents, or an add or dedupe because the destination
+	// listing may have.
+	ReasonIncompleteListing = "incomplete_listing"
+	// ReasonDuplicate marks an extra copy of a hash already on the
+	// destination.
+	ReasonDuplicate = "duplicate"
+
+	// Resumes carry the destination torrent's status as their reason.
+	ReasonWaitingFiles     = rdapi.StatusWaitingFiles
+	ReasonMagnetConversion = rdapi.StatusMagnetConversion
+)
+
+// Plan actions, as used in CSV rows and plan diffs.
+const (
+	ActionAdd       = "add"
+	ActionDelete    = "delete"
+	ActionResume    = "resume"
+	ActionDedupe    = "dedupe"
+	ActionProtected = "protected"
+	ActionSkipped   = "skipped"
+)
+
+// PlanItem is a single torrent in a plan and why it is there.
+type PlanItem struct {
+	Hash     string `json:"hash"`
+	Name     string `json:"name"`
+	SourceID string `json:"source_id,omitempty"`
+	DestID   string `json:"dest_id,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// Plan is the set of changes needed to bring the destination in line with the
+// source. Deletes are only populated in mirror-delete mode; in add-only mode
+// destination-only torrents are listed under Skipped instead. Resumes are
+// mirrored torrents the destination has but whose files were never selected,
+// e.g. because an earlier run died between adding and selecting. Dedupes are
+// extra copies of hashes the destination holds more than once; without
+// RunnerConfig.Dedupe they are listed under Skipped instead.
+type Plan struct {
+	Dest      string    `json:"dest"`
+	Mode      Mode      `json:"mode"`
+	DryRun    bool      `json:"dry_run"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Adds      []PlanItem `json:"adds"`
+	Resumes   []PlanItem `json:"resumes"`
+	Deletes   []PlanItem `json:"deletes"`
+	Dedupes   []PlanItem `json:"dedupes"`
+	Protected []PlanItem `json:"protected"`
+	Skipped   []PlanItem `json:"skipped"`
+}
+
+// PlanRow is a plan item flattened with its action.
+type PlanRow struct {
+	Action string `json:"action"`
+	PlanItem
+}
+
+// Rows flattens the plan into rows in add, resume, delete, dedupe, protected,
+// skipped order.
+func (p Plan) Rows() []PlanRow {
+	rows := make([]PlanRow, 0, len(p.Adds)+len(p.Resumes)+len(p.Deletes)+len(p.Dedupes)+len(p.Protected)+len(p.Skipped))
+	for _, g := range []struct {
+		action string
+		items  []PlanItem
+	}{
+		{ActionAdd, p.Adds},
+		{ActionResume, p.Resumes},
+		{ActionDelete, p.Deletes},
+		{ActionDedupe, p.Dedupes},
+		{ActionProtected, p.Protected},
+		{ActionSkipped, p.Skipped},
+	} {
+		for _, it := range g.items {
+			rows = append(rows, PlanRow{Action: g.action, PlanItem: it})
+		}
+	}
+	return rows
+}
+
+// WriteJSON writes the plan as indented JSON.
+func (p Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// csvHeader is the column order used by WriteCSV.
+var csvHeader = []string{"dest", "action", "hash", "name", "source_id", "dest_id", "reason"}
+
+// WriteCSV writes the plan as CSV, one row per item, with a header row.
+func (p Plan) WriteCSV(w io.Writer) error {
+	return WritePlansCSV(w, []Plan{p})
+}
+
+// WritePlansCSV writes several plans into a single CSV with one header row.
+func WritePlansCSV(w io.Writer, plans []Plan) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, p := range plans {
+		for _, r := range p.Rows() {
+			if err := cw.Write([]string{p.Dest, r.Action, r.Hash, r.Name, r.SourceID, r.DestID, r.Reason}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadPlanJSON reads a plan previously written with WriteJSON.
+func ReadPlanJSON(r io.Reader) (Plan, error) {
+	var p Plan
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return Plan{}, err
+	}
+	return p, nil
+}
+
+// SavePlan writes the plan to dir as "<dest>.plan.<format>", replacing the
+// previous run's file atomically. format is "json" or "csv".
+func SavePlan(dir, format string, p Plan) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, planFileName(p.Dest, format))
+	tmp, err := os.CreateTemp(dir, ".plan-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	switch format {
+	case "csv":
+		err = p.WriteCSV(tmp)
+	case "json":
+		err = p.WriteJSON(tmp)
+	default:
+		err = fmt.Errorf("unknown plan format %q", format)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func planFileName(dest, format string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, dest)
+	return safe + ".plan." + format
+}
+
+// PlanDiff is the difference between two plans for the same destination.
+// New holds rows that appear only in the current plan, Gone rows that only
+// appeared in the previous one. A row that changes action shows up in both.
+type PlanDiff struct {
+	New  []PlanRow `json:"new"`
+	Gone []PlanRow `json:"gone"`
+}
+
+// Empty reports whether the two plans had the same rows.
+func (d PlanDiff) Empty() bool {
+	return len(d.New) == 0 && len(d.Gone) == 0
+}
+
+// DiffPlans compares prev and cur by (action, hash, source id, dest id),
+// ignoring names and timestamps.
+func DiffPlans(prev, cur Plan) PlanDiff {
+	key := func(r PlanRow) string { return r.Action + "|" + r.Hash + "|" + r.SourceID + "|" + r.DestID }
+
+	prevRows := prev.Rows()
+	curRows := cur.Rows()
+	inPrev := make(map[string]bool, len(prevRows))
+	for _, r := range prevRows {
+		inPrev[key(r)] = true
+	}
+	inCur := make(map[string]bool, len(curRows))
+	for _, r := range curRows {
+		inCur[key(r)] = true
+	}
+
+	d := PlanDiff{New: []PlanRow{}, Gone: []PlanRow{}}
+	for _, r := range curRows {
+		if !inPrev[key(r)] {
+			d.New = append(d.New, r)
+		}
+	}
+	for _, r := range prevRows {
+		if !inCur[key(r)] {
+			d.Gone = append(d.Gone, r)
+		}
+	}
+	sort.SliceStable(d.New, func(i, j int) bool { return d.New[i].Hash < d.New[j].Hash })
+	sort.SliceStable(d.Gone, func(i, j int) bool { return d.Gone[i].Hash < d.Gone[j].Hash })
+	return d
+}
@@ -0,0 +1,104 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rdmirrorsync/internal/rdapi"
+)
+
+func TestPlanAddOnlyListsDestOnlyAsSkipped(t *testing.T) {
+	api := &fakeAPI{
+		src: []rdapi.Torrent{{ID: "1", Hash: "A"}, {ID: "2", Hash: ""}},
+		dst: []rdapi.Torrent{{ID: "d1", Hash: "B", Filename: "Local"}},
+	}
+	r := NewRunner(api, RunnerConfig{Name: "x", SrcToken: "src", DstToken: "dst", Mode: ModeAddOnly})
+
+	plan, _, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if plan.Dest != "x" || plan.Mode != ModeAddOnly {
+		t.Fatalf("unexpected plan metadata: %+v", plan)
+	}
+	if len(plan.Deletes) != 0 {
+		t.Fatalf("add-only plan must not delete, got %+v", plan.Deletes)
+	}
+	reasons := map[string]bool{}
+	for _, it := range plan.Skipped {
+		reasons[it.Reason] = true
+	}
+	if len(plan.Skipped) != 2 || !reasons[ReasonAddOnlyMode] || !reasons[ReasonEmptySourceHash] {
+		t.Fatalf("unexpected skipped items: %+v", plan.Skipped)
+	}
+}
+
+func TestPlanWriteCSV(t *testing.T) {
+	plan := Plan{
+		Dest:      "x",
+		Adds:      []PlanItem{{Hash: "a", Name: "Movie, The", SourceID: "1", Reason: ReasonMissingOnDest}},
+		Protected: []PlanItem{{Hash: "b", Name: "[KEEP]", DestID: "d2", Reason: ReasonProtectRegex}},
+	}
+	var buf bytes.Buffer
+	if err := plan.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read back CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected header + 2 rows, got %d", len(rows))
+	}
+	if rows[1][1] != ActionAdd || rows[1][3] != "Movie, The" {
+		t.Errorf("unexpected add row: %v", rows[1])
+	}
+	if rows[2][1] != ActionProtected || rows[2][5] != "d2" {
+		t.Errorf("unexpected protected row: %v", rows[2])
+	}
+}
+
+func TestDiffPlans(t *testing.T) {
+	prev := Plan{
+		Adds:    []PlanItem{{Hash: "a"}, {Hash: "b"}},
+		Skipped: []PlanItem{{Hash: "c", Reason: ReasonAddOnlyMode}},
+	}
+	cur := Plan{
+		Adds:    []PlanItem{{Hash: "b"}, {Hash: "d"}},
+		Deletes: []PlanItem{{Hash: "c", Reason: ReasonNotInSource}},
+	}
+	d := DiffPlans(prev, cur)
+	if len(d.New) != 2 || d.New[0].Hash != "c" || d.New[0].Action != ActionDelete || d.New[1].Hash != "d" {
+		t.Fatalf("unexpected new rows: %+v", d.New)
+	}
+	if len(d.Gone) != 2 || d.Gone[0].Hash != "a" || d.Gone[1].Action != ActionSkipped {
+		t.Fatalf("unexpected gone rows: %+v", d.Gone)
+	}
+	if !DiffPlans(cur, cur).Empty() {
+		t.Fatal("expected identical plans to have an empty diff")
+	}
+}
+
+func TestSavePlanRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	plan := Plan{Dest: "loc/1", Adds: []PlanItem{{Hash: "a", Reason: ReasonMissingOnDest}}}
+	if err := SavePlan(dir, "json", plan); err != nil {
+		t.Fatalf("SavePlan failed: %v", err)
+	}
+	f, err := os.Open(filepath.Join(dir, "loc_1.plan.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := ReadPlanJSON(f)
+	if err != nil {
+		t.Fatalf("ReadPlanJSON failed: %v", err)
+	}
+	if got.Dest != "loc/1" || len(got.Adds) != 1 || got.Adds[0].Hash != "a" {
+		t.Fatalf("unexpected round-tripped plan: %+v", got)
+	}
+}
@@ -2,14 +2,17 @@ package syncer
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
 
+	"rdmirrorsync/internal/logging"
 	"rdmirrorsync/internal/rdapi"
+	"rdmirrorsync/internal/tracing"
 )
 
 type Mode string
@@ -20,6 +23,9 @@ const (
 )
 
 type RunnerConfig struct {
+	// Name identifies the destination in plans.
+	Name string
+
 	SrcToken string
 	DstToken string
 
@@ -27,29 +33,143 @@ type RunnerConfig struct {
 	DryRun     bool
 	WriteDelay time.Duration
 
+	// DrainTimeout is how long an add+select or delete already under way may
+	// keep going after ctx is cancelled, so shutdown does not leave a torrent
+	// added but never selected. Zero abandons it immediately.
+	DrainTimeout time.Duration
+
 	ProtectDstRegex string
+
+	// DeleteGate, when set, must allow a mirror-delete run's deletes before
+	// they execute. Adds are never gated.
+	DeleteGate DeleteGate
+
+	// Tracer, when set, records a span per run and per add, select and delete.
+	Tracer *tracing.Tracer
+
+	// Logger receives the runner's logs; it should carry the dest attribute.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Auditor, when set, records every add and delete the runner attempts.
+	// Dry runs are not recorded.
+	Auditor Auditor
+
+	// Failures, when set, remembers failed adds across runs; hashes it holds
+	// back are skipped instead of added.
+	Failures FailureTracker
+
+	// Lists, when set, supplies hashes never to add (ignore) or delete (pin).
+	Lists HashLists
+
+	// Dedupe deletes extra copies of hashes the destination holds more than
+	// once, keeping the healthiest copy, or the oldest of equally healthy
+	// ones. It applies in either mode.
+	Dedupe bool
+
+	// FullReconcile is how long the destination model built from a listing
+	// may be planned from before the destination is listed again. Zero lists
+	// the destination on every run.
+	FullReconcile time.Duration
+}
+
+// HashLists supplies a destination's manually managed hash lists. They are
+// loaded at the start of every run so edits apply without a restart.
+type HashLists interface {
+	Load() (ignore, pin map[string]bool, err error)
+}
+
+// FailureTracker remembers adds that keep failing so later runs back off
+// from them and eventually quarantine them.
+type FailureTracker interface {
+	// Held returns the hashes not to add at now, mapped to
+	// ReasonFailureBackoff or ReasonQuarantined.
+	Held(now time.Time) (map[string]string, error)
+	// AddFailed records a failed add of it.
+	AddFailed(it PlanItem, err error) error
+	// AddSucceeded forgets earlier failures of hash.
+	AddSucceeded(hash string) error
 }
 
+// Auditor records changes made to a destination.
+type Auditor interface {
+	Record(e AuditEvent) error
+}
+
+// AuditEvent is one attempted add or delete.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Dest      string    `json:"dest"`
+	Action    string    `json:"action"` // ActionAdd or ActionDelete
+	Hash      string    `json:"hash"`
+	Name      string    `json:"name"`
+	TorrentID string    `json:"torrent_id,omitempty"`
+	Reason    string    `json:"reason"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// DeleteGate holds back deletes until a human approves them.
+type DeleteGate interface {
+	// AllowDeletes reports whether the plan's deletes may execute now. It is
+	// called on every non-dry-run mirror-delete run, including ones with no
+	// deletes, so the gate can invalidate plans that went stale.
+	AllowDeletes(plan Plan) (bool, error)
+	// DeletesApplied is called after an allowed plan's deletes were attempted.
+	DeletesApplied(plan Plan) error
+}
+
+// ErrInterrupted is returned by RunOnce when ctx is cancelled while the plan
+// is being applied. The Stats returned with it cover the work that was done.
+var ErrInterrupted = errors.New("run interrupted")
+
 type Stats struct {
 	SourceCount int `json:"source_count"`
 	DestCount   int `json:"dest_count"`
 
 	NeedAdd    int `json:"need_add"`
+	NeedResume int `json:"need_resume"`
 	NeedDelete int `json:"need_delete"`
 
 	Added         int `json:"added"`
+	Resumed       int `json:"resumed"`
 	Deleted       int `json:"deleted"`
 	AddErrors     int `json:"add_errors"`
 	DeleteErrors  int `json:"delete_errors"`
 	SkippedBadSrc int `json:"skipped_bad_src"`
 	ProtectedDst  int `json:"protected_dst"`
 
+	// Adds held back because earlier attempts failed.
+	BackingOff  int `json:"backing_off"`
+	Quarantined int `json:"quarantined"`
+
+	// Adds and deletes left out because of the ignore and pin lists.
+	Ignored int `json:"ignored"`
+	Pinned  int `json:"pinned"`
+
+	AwaitingApproval int `json:"awaiting_approval"`
+
+	// Duplicates counts extra copies of hashes the destination holds more
+	// than once; Deduped is how many of them the run deleted.
+	Duplicates int `json:"duplicates"`
+	Deduped    int `json:"deduped"`
+
+	// DestCached is set when the run planned from the destination model
+	// instead of listing the destination.
+	DestCached bool `json:"dest_cached,omitempty"`
+
+	// IncompleteListing is set when a library listing still disagreed with
+	// RD's count after retries; deletes are held back for the run.
+	IncompleteListing bool `json:"incomplete_listing,omitempty"`
+
+	// Interrupted is set when the run stopped before applying the whole plan.
+	Interrupted bool `json:"interrupted,omitempty"`
+
 	StartedAt  time.Time `json:"started_at"`
 	FinishedAt time.Time `json:"finished_at"`
 }
 
 type API interface {
-	ListAllTorrents(ctx context.Context, token string) ([]rdapi.Torrent, error)
+	ListTorrentPages(ctx context.Context, token string, reset func(), fn func(page []rdapi.Torrent) error) error
 	AddMagnetByHash(ctx context.Context, token, hash string) (string, error)
 	SelectFilesAll(ctx context.Context, token, torrentID string) error
 	DeleteTorrent(ctx context.Context, token, torrentID string) error
@@ -58,159 +178,660 @@ type API interface {
 type Runner struct {
 	api API
 	cfg RunnerConfig
+	log *slog.Logger
+
+	lastPlan Plan
+	dst      *destModel // nil until listed, or when it cannot be trusted
 }
 
 func NewRunner(api API, cfg RunnerConfig) *Runner {
-	return &Runner{api: api, cfg: cfg}
+	l := cfg.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	return &Runner{api: api, cfg: cfg, log: l}
 }
 
-func (r *Runner) RunOnce(ctx context.Context) (Stats, error) {
-	stats := Stats{StartedAt: time.Now()}
+// SetDryRun changes the dry-run setting for subsequent runs. Like LastPlan,
+// it must be called from the goroutine that calls RunOnce.
+func (r *Runner) SetDryRun(v bool) {
+	r.cfg.DryRun = v
+}
 
-	src, err := r.api.ListAllTorrents(ctx, r.cfg.SrcToken)
-	if err != nil {
-		return stats, err
-	}
-	dst, err := r.api.ListAllTorrents(ctx, r.cfg.DstToken)
-	if err != nil {
-		return stats, err
-	}
+// LastPlan returns the plan computed by the most recent RunOnce. It must be
+// called from the goroutine that calls RunOnce.
+func (r *Runner) LastPlan() Plan {
+	return r.lastPlan
+}
 
-	stats.SourceCount = len(src)
-	stats.DestCount = len(dst)
+// Plan lists both libraries and computes the adds and deletes a run would
+// perform, along with the protected and skipped items, without writing
+// anything to the destination.
+func (r *Runner) Plan(ctx context.Context) (Plan, Stats, error) {
+	stats := Stats{StartedAt: time.Now()}
+	plan := Plan{
+		Dest:      r.cfg.Name,
+		Mode:      r.cfg.Mode,
+		DryRun:    r.cfg.DryRun,
+		CreatedAt: stats.StartedAt,
+		Adds:      []PlanItem{},
+		Resumes:   []PlanItem{},
+		Deletes:   []PlanItem{},
+		Dedupes:   []PlanItem{},
+		Protected: []PlanItem{},
+		Skipped:   []PlanItem{},
+	}
 
 	var protectRe *regexp.Regexp
 	if r.cfg.ProtectDstRegex != "" {
 		re, err := regexp.Compile(r.cfg.ProtectDstRegex)
 		if err != nil {
-			return stats, err
+			return plan, stats, err
 		}
 		protectRe = re
 	}
 
-	srcByHash := make(map[string]rdapi.Torrent, len(src))
-	dstByHash := make(map[string]rdapi.Torrent, len(dst))
-
-	for _, t := range src {
+	// Both libraries are streamed page by page and only the fields the plan
+	// needs are kept, so a library of a few hundred thousand torrents never
+	// sits in memory twice.
+	srcByHash := make(map[string]srcEntry)
+	// A listing that stays inconsistent with RD's count is still planned
+	// from, but may be missing torrents, so it blocks deletes below.
+	resetSrc := func() {
+		clear(srcByHash)
+		stats.SkippedBadSrc = 0
+		plan.Skipped = plan.Skipped[:0]
+	}
+	n, err := r.list(ctx, "source", r.cfg.SrcToken, resetSrc, func(t rdapi.Torrent) {
 		h := normalizeHash(t.Hash)
 		if h == "" {
 			stats.SkippedBadSrc++
-			continue
+			plan.Skipped = append(plan.Skipped, PlanItem{Name: t.Filename, SourceID: t.ID, Reason: ReasonEmptySourceHash})
+			return
 		}
-		srcByHash[h] = t
+		srcByHash[h] = srcEntry{id: t.ID, name: t.Filename}
+	})
+	if err != nil && !errors.Is(err, rdapi.ErrIncompleteListing) {
+		return plan, stats, err
 	}
-	for _, t := range dst {
-		h := normalizeHash(t.Hash)
-		if h == "" {
+	stats.SourceCount = n
+	stats.IncompleteListing = err != nil
+
+	// The destination is planned from the model when it is fresh, and
+	// listed otherwise. A listing is kept as the model only when later runs
+	// may plan from it.
+	dst := r.cachedDest(stats.StartedAt)
+	dstIncomplete := false
+	if dst != nil {
+		stats.DestCached = true
+	} else {
+		listing := newDestModel(stats.StartedAt)
+		r.dst = nil
+		n, err = r.list(ctx, "destination", r.cfg.DstToken, func() {
+			clear(listing.byHash)
+			clear(listing.dupes)
+		}, func(t rdapi.Torrent) {
+			h := normalizeHash(t.Hash)
+			if h == "" {
+				return
+			}
+			listing.listed(h, dstEntry{id: t.ID, name: t.Filename, status: t.Status, added: t.Added})
+		})
+		if err != nil && !errors.Is(err, rdapi.ErrIncompleteListing) {
+			return plan, stats, err
+		}
+		listing.count = n
+		dstIncomplete = err != nil
+		stats.IncompleteListing = stats.IncompleteListing || dstIncomplete
+		if r.cfg.FullReconcile > 0 && err == nil {
+			r.dst = listing
+		}
+		dst = listing
+	}
+	stats.DestCount = dst.count
+	stats.Duplicates = dst.duplicates()
+
+	stuck := make(map[string]dstEntry)
+	dstOnlyByHash := make(map[string]dstEntry)
+	for h, t := range dst.byHash {
+		e, ok := srcByHash[h]
+		switch {
+		case !ok:
+			dstOnlyByHash[h] = t
 			continue
+		case t.status == rdapi.StatusWaitingFiles || t.status == rdapi.StatusMagnetConversion:
+			stuck[h] = t
+		}
+		e.onDest = true
+		srcByHash[h] = e
+	}
+
+	// A pin list that cannot be read must not turn into deletes, so this
+	// fails the run.
+	var ignore, pin map[string]bool
+	if r.cfg.Lists != nil {
+		ignore, pin, err = r.cfg.Lists.Load()
+		if err != nil {
+			return plan, stats, fmt.Errorf("load ignore and pin lists: %w", err)
+		}
+	}
+
+	var held map[string]string
+	if r.cfg.Failures != nil {
+		held, err = r.cfg.Failures.Held(stats.StartedAt)
+		if err != nil {
+			r.log.Error("read add failures failed; not holding any adds back", logging.KeyOp, "add", logging.Err(err))
 		}
-		dstByHash[h] = t
 	}
 
+	// A destination listing that may be missing torrents would re-add ones
+	// already there, so it holds adds and dedupes as well as deletes.
 	needAdd := make([]string, 0)
-	for h := range srcByHash {
-		if _, ok := dstByHash[h]; !ok {
+	heldBack := make([]string, 0)
+	ignored := make([]string, 0)
+	incomplete := make([]string, 0)
+	for h, e := range srcByHash {
+		switch {
+		case e.onDest:
+		case ignore[h]:
+			ignored = append(ignored, h)
+		case held[h] != "":
+			heldBack = append(heldBack, h)
+		case dstIncomplete:
+			incomplete = append(incomplete, h)
+		default:
 			needAdd = append(needAdd, h)
 		}
 	}
+	needResume := make([]string, 0, len(stuck))
+	for h := range stuck {
+		needResume = append(needResume, h)
+	}
 	sort.Strings(needAdd)
+	sort.Strings(needResume)
+	sort.Strings(heldBack)
+	sort.Strings(ignored)
+	sort.Strings(incomplete)
 	stats.NeedAdd = len(needAdd)
+	stats.NeedResume = len(needResume)
 
-	needDelete := make([]string, 0)
-	if r.cfg.Mode == ModeMirrorDelete {
-		for h, dstT := range dstByHash {
-			if _, ok := srcByHash[h]; ok {
-				continue
+	dstOnly := make([]string, 0, len(dstOnlyByHash))
+	for h := range dstOnlyByHash {
+		dstOnly = append(dstOnly, h)
+	}
+	sort.Strings(dstOnly)
+
+	for _, h := range needAdd {
+		srcT := srcByHash[h]
+		plan.Adds = append(plan.Adds, PlanItem{Hash: h, Name: srcT.name, SourceID: srcT.id, Reason: ReasonMissingOnDest})
+	}
+	for _, h := range incomplete {
+		srcT := srcByHash[h]
+		plan.Skipped = append(plan.Skipped, PlanItem{Hash: h, Name: srcT.name, SourceID: srcT.id, Reason: ReasonIncompleteListing})
+	}
+	for _, h := range ignored {
+		srcT := srcByHash[h]
+		stats.Ignored++
+		plan.Skipped = append(plan.Skipped, PlanItem{Hash: h, Name: srcT.name, SourceID: srcT.id, Reason: ReasonIgnored})
+	}
+	for _, h := range heldBack {
+		srcT := srcByHash[h]
+		if held[h] == ReasonQuarantined {
+			stats.Quarantined++
+		} else {
+			stats.BackingOff++
+		}
+		plan.Skipped = append(plan.Skipped, PlanItem{Hash: h, Name: srcT.name, SourceID: srcT.id, Reason: held[h]})
+	}
+	for _, h := range needResume {
+		srcT, dstT := srcByHash[h], stuck[h]
+		plan.Resumes = append(plan.Resumes, PlanItem{Hash: h, Name: srcT.name, SourceID: srcT.id, DestID: dstT.id, Reason: dstT.status})
+	}
+	heldDeletes, heldDedupes := 0, 0
+	deleting := make(map[string]bool)
+	for _, h := range dstOnly {
+		dstT := dstOnlyByHash[h]
+		item := PlanItem{Hash: h, Name: dstT.name, DestID: dstT.id}
+		switch {
+		case r.cfg.Mode != ModeMirrorDelete:
+			// Listed so the plan shows what switching to mirror-delete would remove.
+			item.Reason = ReasonAddOnlyMode
+			plan.Skipped = append(plan.Skipped, item)
+		case pin[h]:
+			stats.Pinned++
+			item.Reason = ReasonPinned
+			plan.Protected = append(plan.Protected, item)
+		case protectRe != nil && protectRe.MatchString(dstT.name):
+			stats.ProtectedDst++
+			item.Reason = ReasonProtectRegex
+			plan.Protected = append(plan.Protected, item)
+		case stats.IncompleteListing:
+			heldDeletes++
+			item.Reason = ReasonIncompleteListing
+			plan.Skipped = append(plan.Skipped, item)
+		default:
+			item.Reason = ReasonNotInSource
+			plan.Deletes = append(plan.Deletes, item)
+			// Every copy goes, not only the one kept.
+			for _, d := range dst.dupes[h] {
+				plan.Deletes = append(plan.Deletes, PlanItem{Hash: h, Name: d.name, DestID: d.id, Reason: ReasonNotInSource})
 			}
-			if protectRe != nil && protectRe.MatchString(dstT.Filename) {
-				stats.ProtectedDst++
-				continue
+			deleting[h] = true
+		}
+	}
+	stats.NeedDelete = len(plan.Deletes)
+
+	dupHashes := make([]string, 0, len(dst.dupes))
+	for h := range dst.dupes {
+		if !deleting[h] {
+			dupHashes = append(dupHashes, h)
+		}
+	}
+	sort.Strings(dupHashes)
+	for _, h := range dupHashes {
+		for _, d := range dst.dupes[h] {
+			item := PlanItem{Hash: h, Name: d.name, DestID: d.id, Reason: ReasonDuplicate}
+			switch {
+			case !r.cfg.Dedupe:
+				// Listed so the plan shows what dedupe would remove.
+				plan.Skipped = append(plan.Skipped, item)
+			case dstIncomplete:
+				heldDedupes++
+				item.Reason = ReasonIncompleteListing
+				plan.Skipped = append(plan.Skipped, item)
+			default:
+				plan.Dedupes = append(plan.Dedupes, item)
 			}
-			needDelete = append(needDelete, h)
 		}
-		sort.Strings(needDelete)
 	}
-	stats.NeedDelete = len(needDelete)
 
-	for _, h := range needAdd {
-		srcT := srcByHash[h]
+	if n := len(incomplete) + heldDeletes + heldDedupes; n > 0 {
+		r.log.Warn("listing incomplete; holding back changes this run", logging.KeyOp, "sync",
+			"adds", len(incomplete), "deletes", heldDeletes, "dedupes", heldDedupes)
+	}
+
+	return plan, stats, nil
+}
+
+// srcEntry is what Plan keeps of a source torrent.
+type srcEntry struct {
+	id, name string
+	onDest   bool
+}
+
+// dstEntry is what Plan keeps of a destination torrent it may act on.
+type dstEntry struct {
+	id, name, status string
+	added            string // RD's ISO 8601 timestamp
+}
+
+// list streams one side's library to fn under a "sync.list" span and returns
+// how many torrents it saw. reset is called when the listing starts over.
+// Like the API, it returns rdapi.ErrIncompleteListing after streaming a
+// listing that may be missing torrents.
+func (r *Runner) list(ctx context.Context, side, token string, reset func(), fn func(rdapi.Torrent)) (int, error) {
+	ctx, span := r.cfg.Tracer.Start(ctx, "sync.list", tracing.String("dest", r.cfg.Name), tracing.String("side", side))
+	defer span.End()
+	n := 0
+	err := r.api.ListTorrentPages(ctx, token, func() {
+		n = 0
+		reset()
+	}, func(page []rdapi.Torrent) error {
+		for _, t := range page {
+			fn(t)
+		}
+		n += len(page)
+		return nil
+	})
+	span.RecordError(err)
+	span.SetAttributes(tracing.Int("count", n))
+	if errors.Is(err, rdapi.ErrIncompleteListing) {
+		r.log.Warn("listing incomplete", "side", side, "count", n, logging.Err(err))
+	}
+	return n, err
+}
+
+// RunOnce computes the plan and applies it to the destination. The plan is
+// kept and can be read with LastPlan once RunOnce returns.
+func (r *Runner) RunOnce(ctx context.Context) (stats Stats, err error) {
+	ctx, span := r.cfg.Tracer.Start(ctx, "sync.run",
+		tracing.String("dest", r.cfg.Name), tracing.String("mode", string(r.cfg.Mode)), tracing.Bool("dry_run", r.cfg.DryRun))
+	defer func() {
+		span.SetAttributes(
+			tracing.Int("need_add", stats.NeedAdd), tracing.Int("need_delete", stats.NeedDelete),
+			tracing.Int("added", stats.Added), tracing.Int("resumed", stats.Resumed), tracing.Int("deleted", stats.Deleted),
+			tracing.Int("add_errors", stats.AddErrors), tracing.Int("delete_errors", stats.DeleteErrors),
+			tracing.Int("duplicates", stats.Duplicates), tracing.Int("deduped", stats.Deduped),
+			tracing.Bool("dest_cached", stats.DestCached))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	ctx = logging.NewContext(ctx, r.log)
+
+	plan, stats, err := r.Plan(ctx)
+	r.lastPlan = plan
+	if err != nil {
+		return stats, err
+	}
+
+	for i, it := range plan.Adds {
+		if ctx.Err() != nil {
+			return r.interrupted(ctx, stats, len(plan.Adds)-i+len(plan.Resumes)+len(plan.Deletes)+len(plan.Dedupes))
+		}
+		l := r.log.With(logging.KeyHash, it.Hash, "name", it.Name)
 		if r.cfg.DryRun {
-			log.Printf("[DRY_RUN] add hash=%s name=%q", h, srcT.Filename)
+			l.Info("dry run: would add", logging.KeyOp, "add", "dry_run", true)
 			continue
 		}
 
-		newID, err := r.api.AddMagnetByHash(ctx, r.cfg.DstToken, h)
-		if err != nil {
+		if r.applyAdd(ctx, it, l) {
+			stats.Added++
+		} else {
 			stats.AddErrors++
-			log.Printf("add failed hash=%s name=%q err=%v", h, srcT.Filename, err)
-			continue
 		}
-		if err := selectFilesWithRetry(ctx, r.api, r.cfg.DstToken, newID, 2*time.Second, 3, 3*time.Second); err != nil {
-			stats.AddErrors++
-			log.Printf("select files failed id=%s hash=%s name=%q err=%v", newID, h, srcT.Filename, err)
+		_ = sleep(ctx, r.cfg.WriteDelay)
+	}
+
+	for i, it := range plan.Resumes {
+		if ctx.Err() != nil {
+			return r.interrupted(ctx, stats, len(plan.Resumes)-i+len(plan.Deletes)+len(plan.Dedupes))
+		}
+		l := r.log.With(logging.KeyHash, it.Hash, "name", it.Name, logging.KeyTorrentID, it.DestID, "dest_status", it.Reason)
+		if r.cfg.DryRun {
+			l.Info("dry run: would resume file selection", logging.KeyOp, "select_files", "dry_run", true)
 			continue
 		}
 
-		stats.Added++
-		log.Printf("added hash=%s name=%q id=%s", h, srcT.Filename, newID)
-		if r.cfg.WriteDelay > 0 {
-			time.Sleep(r.cfg.WriteDelay)
+		switch r.applyResume(ctx, it, l) {
+		case resumeDone:
+			stats.Resumed++
+		case resumeFailed:
+			stats.AddErrors++
 		}
+		_ = sleep(ctx, r.cfg.WriteDelay)
 	}
 
 	if r.cfg.Mode == ModeMirrorDelete {
-		for _, h := range needDelete {
-			dstT := dstByHash[h]
-			if r.cfg.DryRun {
-				log.Printf("[DRY_RUN] delete hash=%s name=%q id=%s", h, dstT.Filename, dstT.ID)
-				continue
+		deletes := plan.Deletes
+		gated := r.cfg.DeleteGate != nil && !r.cfg.DryRun
+		if gated {
+			ok, err := r.cfg.DeleteGate.AllowDeletes(plan)
+			if err != nil {
+				r.log.Error("delete approval check failed, holding deletes", logging.KeyOp, "delete", logging.Err(err))
 			}
-			if dstT.ID == "" {
-				stats.DeleteErrors++
-				log.Printf("skip delete hash=%s name=%q empty id", h, dstT.Filename)
+			if !ok || err != nil {
+				stats.AwaitingApproval = len(deletes)
+				if len(deletes) > 0 {
+					r.log.Warn("holding deletes until the plan is approved", logging.KeyOp, "delete", "count", len(deletes))
+				}
+				deletes = nil
+				gated = false
+			}
+		}
+
+		for i, it := range deletes {
+			if ctx.Err() != nil {
+				return r.interrupted(ctx, stats, len(deletes)-i+len(plan.Dedupes))
+			}
+			l := r.log.With(logging.KeyHash, it.Hash, "name", it.Name, logging.KeyTorrentID, it.DestID)
+			if r.cfg.DryRun {
+				l.Info("dry run: would delete", logging.KeyOp, "delete", "dry_run", true)
 				continue
 			}
-			if err := r.api.DeleteTorrent(ctx, r.cfg.DstToken, dstT.ID); err != nil {
+			if !r.applyDelete(ctx, it, l) {
 				stats.DeleteErrors++
-				log.Printf("delete failed hash=%s name=%q id=%s err=%v", h, dstT.Filename, dstT.ID, err)
 				continue
 			}
 			stats.Deleted++
-			log.Printf("deleted hash=%s name=%q id=%s", h, dstT.Filename, dstT.ID)
-			if r.cfg.WriteDelay > 0 {
-				time.Sleep(r.cfg.WriteDelay)
+			l.Info("deleted", logging.KeyOp, "delete")
+			_ = sleep(ctx, r.cfg.WriteDelay)
+		}
+
+		if gated && len(deletes) > 0 {
+			if err := r.cfg.DeleteGate.DeletesApplied(plan); err != nil {
+				r.log.Error("record applied delete plan failed", logging.KeyOp, "delete", logging.Err(err))
 			}
 		}
 	}
 
+	// Dedupes keep a copy of every hash, so they are neither limited to
+	// mirror-delete nor held for approval.
+	for i, it := range plan.Dedupes {
+		if ctx.Err() != nil {
+			return r.interrupted(ctx, stats, len(plan.Dedupes)-i)
+		}
+		l := r.log.With(logging.KeyHash, it.Hash, "name", it.Name, logging.KeyTorrentID, it.DestID)
+		if r.cfg.DryRun {
+			l.Info("dry run: would delete duplicate", logging.KeyOp, "delete", "dry_run", true)
+			continue
+		}
+		if !r.applyDelete(ctx, it, l) {
+			stats.DeleteErrors++
+			continue
+		}
+		stats.Deduped++
+		l.Info("deleted duplicate", logging.KeyOp, "delete")
+		_ = sleep(ctx, r.cfg.WriteDelay)
+	}
+
 	stats.FinishedAt = time.Now()
 	return stats, nil
 }
 
-// selectFilesWithRetry calls SelectFilesAll after an initial delay, then retries on failure.
-// Real-Debrid often needs a few seconds after addMagnet before the torrent is ready for file selection.
-func selectFilesWithRetry(ctx context.Context, api API, token, torrentID string, initialDelay time.Duration, maxAttempts int, retryDelay time.Duration) error {
-	sleep := func(d time.Duration) error {
-		timer := time.NewTimer(d)
-		defer timer.Stop()
+// applyDelete deletes one destination torrent, reporting whether it
+// succeeded. Once started it runs to completion, or until DrainTimeout after
+// ctx is cancelled.
+func (r *Runner) applyDelete(ctx context.Context, it PlanItem, l *slog.Logger) bool {
+	if it.DestID == "" {
+		l.Error("skip delete: empty torrent id", logging.KeyOp, "delete")
+		return false
+	}
+	ctx, done := drainContext(ctx, r.cfg.DrainTimeout)
+	defer done()
+	if err := r.delete(logging.NewContext(ctx, l), it); err != nil {
+		l.Error("delete failed", logging.KeyOp, "delete", logging.Err(err))
+		r.audit(ActionDelete, it, it.DestID, err)
+		// The torrent may be gone anyway, or already was.
+		r.distrustDest("delete failed")
+		return false
+	}
+	r.dst.remove(it.Hash, it.DestID)
+	r.audit(ActionDelete, it, it.DestID, nil)
+	return true
+}
+
+// applyAdd adds one torrent and selects its files, reporting whether both
+// succeeded. Once started the pair runs to completion, or until DrainTimeout
+// after ctx is cancelled.
+func (r *Runner) applyAdd(ctx context.Context, it PlanItem, l *slog.Logger) bool {
+	ctx, done := drainContext(ctx, r.cfg.DrainTimeout)
+	defer done()
 
+	newID, err := r.add(ctx, it.Hash)
+	if err != nil {
+		l.Error("add failed", logging.KeyOp, "add", logging.Err(err))
+		r.audit(ActionAdd, it, "", err)
+		// The torrent may have been added anyway.
+		r.distrustDest("add failed")
+		// Adds cut short by shutdown say nothing about the hash.
+		if r.cfg.Failures != nil && ctx.Err() == nil {
+			if err := r.cfg.Failures.AddFailed(it, err); err != nil {
+				l.Error("record add failure failed", logging.KeyOp, "add", logging.Err(err))
+			}
+		}
+		return false
+	}
+	if r.cfg.Failures != nil {
+		if err := r.cfg.Failures.AddSucceeded(it.Hash); err != nil {
+			l.Error("clear add failures failed", logging.KeyOp, "add", logging.Err(err))
+		}
+	}
+	l = l.With(logging.KeyTorrentID, newID)
+	if err := r.selectFiles(logging.NewContext(ctx, l), it.Hash, newID); err != nil {
+		l.Error("select files failed", logging.KeyOp, "select_files", logging.Err(err))
+		r.audit(ActionAdd, it, newID, fmt.Errorf("select files: %w", err))
+		// Left for the next run to resume.
+		r.dst.put(it.Hash, dstEntry{id: newID, name: it.Name, status: rdapi.StatusWaitingFiles})
+		return false
+	}
+	r.dst.put(it.Hash, dstEntry{id: newID, name: it.Name})
+	l.Info("added", logging.KeyOp, "add")
+	r.audit(ActionAdd, it, newID, nil)
+	return true
+}
+
+type resumeResult int
+
+const (
+	resumeDone resumeResult = iota
+	resumeFailed
+	resumePending // the magnet is still converting; try again next run
+)
+
+// applyResume selects all files of a torrent an earlier add left without a
+// selection. A torrent still in magnet conversion cannot be selected yet, so
+// failing on one is expected and not an error.
+func (r *Runner) applyResume(ctx context.Context, it PlanItem, l *slog.Logger) resumeResult {
+	ctx, done := drainContext(ctx, r.cfg.DrainTimeout)
+	defer done()
+	ctx, span := r.cfg.Tracer.Start(logging.NewContext(ctx, l), "sync.resume",
+		tracing.String("dest", r.cfg.Name), tracing.String("hash", it.Hash),
+		tracing.String("torrent_id", it.DestID), tracing.String("status", it.Reason))
+	defer span.End()
+
+	attempts := 3
+	if it.Reason == ReasonMagnetConversion {
+		attempts = 1
+	}
+	err := selectFilesWithRetry(ctx, r.api, r.cfg.DstToken, it.DestID, 0, attempts, 3*time.Second)
+	switch {
+	case err == nil:
+		l.Info("resumed file selection", logging.KeyOp, "select_files")
+		r.audit(ActionAdd, it, it.DestID, nil)
+		r.dst.put(it.Hash, dstEntry{id: it.DestID, name: it.Name})
+		return resumeDone
+	case it.Reason == ReasonMagnetConversion && ctx.Err() == nil:
+		l.Info("magnet still converting; will retry next run", logging.KeyOp, "select_files", logging.Err(err))
+		return resumePending
+	default:
+		span.RecordError(err)
+		l.Error("resume file selection failed", logging.KeyOp, "select_files", logging.Err(err))
+		r.audit(ActionAdd, it, it.DestID, fmt.Errorf("select files: %w", err))
+		return resumeFailed
+	}
+}
+
+// interrupted finishes a run cut short by ctx, leaving remaining items for
+// the next run.
+func (r *Runner) interrupted(ctx context.Context, stats Stats, remaining int) (Stats, error) {
+	stats.Interrupted = true
+	stats.FinishedAt = time.Now()
+	r.log.Warn("run interrupted, leaving remaining items for the next run", "remaining", remaining)
+	return stats, fmt.Errorf("%w: %w", ErrInterrupted, context.Cause(ctx))
+}
+
+// drainContext returns a context that outlives ctx by grace: values are kept
+// but cancellation only arrives grace after ctx is done. done releases it.
+func drainContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	if grace <= 0 {
+		return context.WithCancel(ctx)
+	}
+	drain, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		t := time.NewTimer(grace)
+		defer t.Stop()
 		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-timer.C:
-			return nil
+		case <-t.C:
+			cancel()
+		case <-drain.Done():
 		}
+	})
+	return drain, func() {
+		stop()
+		cancel()
 	}
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
 
-	if err := sleep(initialDelay); err != nil {
+// audit records an attempted add or delete with the Auditor, if any.
+func (r *Runner) audit(action string, it PlanItem, torrentID string, err error) {
+	if r.cfg.Auditor == nil {
+		return
+	}
+	e := AuditEvent{
+		Time:      time.Now().UTC(),
+		Dest:      r.cfg.Name,
+		Action:    action,
+		Hash:      it.Hash,
+		Name:      it.Name,
+		TorrentID: torrentID,
+		Reason:    it.Reason,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err := r.cfg.Auditor.Record(e); err != nil {
+		r.log.Error("write audit log failed", logging.KeyOp, action, logging.KeyHash, it.Hash, logging.Err(err))
+	}
+}
+
+func (r *Runner) add(ctx context.Context, hash string) (string, error) {
+	ctx, span := r.cfg.Tracer.Start(ctx, "sync.add", tracing.String("dest", r.cfg.Name), tracing.String("hash", hash))
+	defer span.End()
+	ctx = logging.NewContext(ctx, logging.FromContext(ctx).With(logging.KeyHash, hash))
+	id, err := r.api.AddMagnetByHash(ctx, r.cfg.DstToken, hash)
+	span.RecordError(err)
+	span.SetAttributes(tracing.String("torrent_id", id))
+	return id, err
+}
+
+func (r *Runner) selectFiles(ctx context.Context, hash, torrentID string) error {
+	ctx, span := r.cfg.Tracer.Start(ctx, "sync.select_files",
+		tracing.String("dest", r.cfg.Name), tracing.String("hash", hash), tracing.String("torrent_id", torrentID))
+	defer span.End()
+	err := selectFilesWithRetry(ctx, r.api, r.cfg.DstToken, torrentID, 2*time.Second, 3, 3*time.Second)
+	span.RecordError(err)
+	return err
+}
+
+func (r *Runner) delete(ctx context.Context, it PlanItem) error {
+	ctx, span := r.cfg.Tracer.Start(ctx, "sync.delete",
+		tracing.String("dest", r.cfg.Name), tracing.String("hash", it.Hash), tracing.String("torrent_id", it.DestID))
+	defer span.End()
+	err := r.api.DeleteTorrent(ctx, r.cfg.DstToken, it.DestID)
+	span.RecordError(err)
+	return err
+}
+
+// selectFilesWithRetry calls SelectFilesAll after an initial delay, then retries on failure.
+// Real-Debrid often needs a few seconds after addMagnet before the torrent is ready for file selection.
+func selectFilesWithRetry(ctx context.Context, api API, token, torrentID string, initialDelay time.Duration, maxAttempts int, retryDelay time.Duration) error {
+	if err := sleep(ctx, initialDelay); err != nil {
 		return err
 	}
 
 	var lastErr error
 	for attempt := 0; attempt < maxAttempts; attempt++ {
 		if attempt > 0 {
-			log.Printf("select files pending, waiting to retry id=%s attempt=%d/%d last_err=%v", torrentID, attempt+1, maxAttempts, lastErr)
-			if err := sleep(retryDelay); err != nil {
+			logging.FromContext(ctx).Info("select files pending, waiting to retry",
+				logging.KeyOp, "select_files", logging.KeyTorrentID, torrentID,
+				logging.KeyAttempt, attempt+1, "max_attempts", maxAttempts, "last_err", lastErr)
+			if err := sleep(ctx, retryDelay); err != nil {
 				return err
 			}
 		}
@@ -1,25 +1,47 @@
 package syncer
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
 	"testing"
+	"time"
 
 	"rdmirrorsync/internal/rdapi"
+	"rdmirrorsync/internal/tracing"
 )
 
 type fakeAPI struct {
 	src []rdapi.Torrent
 	dst []rdapi.Torrent
+	// pageSize splits listings into pages; 0 lists everything in one page.
+	pageSize int
 
 	added   []string
 	deleted []string
 }
 
-func (f *fakeAPI) ListAllTorrents(_ context.Context, token string) ([]rdapi.Torrent, error) {
+func (f *fakeAPI) ListTorrentPages(_ context.Context, token string, _ func(), fn func([]rdapi.Torrent) error) error {
+	ts := f.dst
 	if token == "src" {
-		return f.src, nil
+		ts = f.src
 	}
-	return f.dst, nil
+	for len(ts) > 0 {
+		n := len(ts)
+		if f.pageSize > 0 {
+			n = min(f.pageSize, n)
+		}
+		if err := fn(ts[:n]); err != nil {
+			return err
+		}
+		ts = ts[n:]
+	}
+	return nil
 }
 
 func (f *fakeAPI) AddMagnetByHash(_ context.Context, _ string, hash string) (string, error) {
@@ -72,6 +94,7 @@ func TestRunOnceMirrorDeleteWithProtection(t *testing.T) {
 			{ID: "d2", Hash: "B", Filename: "[KEEP] Local item"},
 			{ID: "d3", Hash: "C", Filename: "Delete me"},
 		},
+		pageSize: 2,
 	}
 	r := NewRunner(api, RunnerConfig{
 		SrcToken:        "src",
@@ -91,3 +114,668 @@ func TestRunOnceMirrorDeleteWithProtection(t *testing.T) {
 		t.Fatalf("expected delete of d3 only, got %+v", api.deleted)
 	}
 }
+
+func TestPlanDoesNotWrite(t *testing.T) {
+	api := &fakeAPI{
+		src: []rdapi.Torrent{
+			{ID: "1", Hash: "A", Filename: "Keep"},
+			{ID: "2", Hash: "B", Filename: "New"},
+		},
+		dst: []rdapi.Torrent{
+			{ID: "d1", Hash: "a", Filename: "Keep"},
+			{ID: "d2", Hash: "C", Filename: "Gone"},
+		},
+	}
+	r := NewRunner(api, RunnerConfig{
+		SrcToken: "src",
+		DstToken: "dst",
+		Mode:     ModeMirrorDelete,
+	})
+
+	plan, stats, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(plan.Adds) != 1 || plan.Adds[0].Hash != "b" || plan.Adds[0].SourceID != "2" {
+		t.Fatalf("unexpected adds: %+v", plan.Adds)
+	}
+	if len(plan.Deletes) != 1 || plan.Deletes[0].Hash != "c" || plan.Deletes[0].DestID != "d2" {
+		t.Fatalf("unexpected deletes: %+v", plan.Deletes)
+	}
+	if stats.NeedAdd != 1 || stats.NeedDelete != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(api.added) != 0 || len(api.deleted) != 0 {
+		t.Fatalf("Plan must not write, got added=%v deleted=%v", api.added, api.deleted)
+	}
+}
+
+type holdGate struct{ applied bool }
+
+func (g *holdGate) AllowDeletes(Plan) (bool, error) { return false, nil }
+func (g *holdGate) DeletesApplied(Plan) error       { g.applied = true; return nil }
+
+func TestRunOnceDeleteGateHoldsDeletesNotAdds(t *testing.T) {
+	api := &fakeAPI{
+		src: []rdapi.Torrent{{ID: "1", Hash: "A"}},
+		dst: []rdapi.Torrent{{ID: "d2", Hash: "B"}},
+	}
+	gate := &holdGate{}
+	r := NewRunner(api, RunnerConfig{
+		SrcToken:   "src",
+		DstToken:   "dst",
+		Mode:       ModeMirrorDelete,
+		DeleteGate: gate,
+	})
+
+	stats, err := r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if stats.Added != 1 || len(api.added) != 1 {
+		t.Fatalf("expected add to proceed, got %+v", stats)
+	}
+	if len(api.deleted) != 0 || stats.AwaitingApproval != 1 || gate.applied {
+		t.Fatalf("expected delete held for approval, got deleted=%v stats=%+v", api.deleted, stats)
+	}
+}
+
+func TestRunOnceTracesSpans(t *testing.T) {
+	api := &fakeAPI{
+		src: []rdapi.Torrent{{ID: "1", Hash: "A"}},
+		dst: []rdapi.Torrent{{ID: "d2", Hash: "B"}},
+	}
+	exp := &tracing.MemoryExporter{}
+	tr := tracing.NewTracer(exp)
+	r := NewRunner(api, RunnerConfig{
+		Name:     "loc1",
+		SrcToken: "src",
+		DstToken: "dst",
+		Mode:     ModeMirrorDelete,
+		Tracer:   tr,
+	})
+	if _, err := r.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	byName := make(map[string][]tracing.SpanData)
+	for _, s := range exp.Spans() {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	if len(byName["sync.run"]) != 1 {
+		t.Fatalf("want one sync.run span, got %v", byName)
+	}
+	run := byName["sync.run"][0]
+	for name, want := range map[string]int{"sync.list": 2, "sync.add": 1, "sync.select_files": 1, "sync.delete": 1} {
+		if len(byName[name]) != want {
+			t.Fatalf("%s: got %d spans, want %d", name, len(byName[name]), want)
+		}
+		for _, s := range byName[name] {
+			if s.ParentID != run.SpanID || s.Attr("dest") != "loc1" {
+				t.Fatalf("%s not a child of sync.run for loc1: %+v", name, s)
+			}
+		}
+	}
+	if h := byName["sync.add"][0].Attr("hash"); h != "a" {
+		t.Fatalf("add hash attribute: got %v", h)
+	}
+	if id := byName["sync.delete"][0].Attr("torrent_id"); id != "d2" {
+		t.Fatalf("delete torrent_id attribute: got %v", id)
+	}
+	if run.Attr("added") != int64(1) || run.Attr("deleted") != int64(1) {
+		t.Fatalf("run attributes: %+v", run.Attrs)
+	}
+}
+
+func TestRunOnceLogsWithDestinationFields(t *testing.T) {
+	api := &fakeAPI{
+		src: []rdapi.Torrent{{ID: "1", Hash: "A", Filename: "Movie"}},
+	}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil)).With("dest", "loc1")
+	r := NewRunner(api, RunnerConfig{
+		SrcToken: "src",
+		DstToken: "dst",
+		Mode:     ModeAddOnly,
+		Logger:   logger,
+	})
+	if _, err := r.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+
+	var added map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("bad log line %q: %v", line, err)
+		}
+		if rec["msg"] == "added" {
+			added = rec
+		}
+	}
+	want := map[string]any{"dest": "loc1", "op": "add", "hash": "a", "torrent_id": "new-id-a", "name": "Movie"}
+	for k, v := range want {
+		if added[k] != v {
+			t.Fatalf("added log %s: got %v, want %v (record %v)", k, added[k], v, added)
+		}
+	}
+}
+
+type recordingAuditor struct{ events []AuditEvent }
+
+func (a *recordingAuditor) Record(e AuditEvent) error {
+	a.events = append(a.events, e)
+	return nil
+}
+
+func TestRunOnceRecordsAuditEvents(t *testing.T) {
+	api := &fakeAPI{
+		src: []rdapi.Torrent{{ID: "1", Hash: "A", Filename: "Movie"}},
+		dst: []rdapi.Torrent{{ID: "d2", Hash: "B", Filename: "Old"}},
+	}
+	aud := &recordingAuditor{}
+	r := NewRunner(api, RunnerConfig{
+		Name:     "loc1",
+		SrcToken: "src",
+		DstToken: "dst",
+		Mode:     ModeMirrorDelete,
+		Auditor:  aud,
+	})
+	if _, err := r.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if len(aud.events) != 2 {
+		t.Fatalf("want 2 audit events, got %+v", aud.events)
+	}
+	add, del := aud.events[0], aud.events[1]
+	if add.Action != ActionAdd || add.Dest != "loc1" || add.Hash != "a" || add.TorrentID != "new-id-a" || add.Reason != ReasonMissingOnDest {
+		t.Fatalf("add event: %+v", add)
+	}
+	if del.Action != ActionDelete || del.Hash != "b" || del.Name != "Old" || del.TorrentID != "d2" || del.Reason != ReasonNotInSource || del.Time.IsZero() {
+		t.Fatalf("delete event: %+v", del)
+	}
+
+	// Dry runs change nothing and are not audited.
+	aud.events = nil
+	r.SetDryRun(true)
+	if _, err := r.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(aud.events) != 0 {
+		t.Fatalf("dry run audited: %+v", aud.events)
+	}
+}
+
+// cancelingAPI cancels the run's context as soon as the first add is made.
+type cancelingAPI struct {
+	fakeAPI
+	cancel context.CancelFunc
+}
+
+func (c *cancelingAPI) AddMagnetByHash(ctx context.Context, token, hash string) (string, error) {
+	c.cancel()
+	return c.fakeAPI.AddMagnetByHash(ctx, token, hash)
+}
+
+func TestRunOnceInterruptedFinishesCurrentAdd(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api := &cancelingAPI{
+		fakeAPI: fakeAPI{src: []rdapi.Torrent{{ID: "1", Hash: "A"}, {ID: "2", Hash: "B"}}},
+		cancel:  cancel,
+	}
+	r := NewRunner(api, RunnerConfig{
+		SrcToken:     "src",
+		DstToken:     "dst",
+		Mode:         ModeAddOnly,
+		WriteDelay:   time.Hour, // must not hold up shutdown
+		DrainTimeout: time.Minute,
+	})
+
+	stats, err := r.RunOnce(ctx)
+	if !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("want ErrInterrupted wrapping context.Canceled, got %v", err)
+	}
+	if !stats.Interrupted || stats.Added != 1 || stats.AddErrors != 0 || stats.FinishedAt.IsZero() {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(api.added) != 1 {
+		t.Fatalf("no new adds may start after cancellation, got %v", api.added)
+	}
+	if len(r.LastPlan().Adds) != 2 {
+		t.Fatalf("the full plan should be kept, got %+v", r.LastPlan().Adds)
+	}
+}
+
+func TestDrainContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, done := drainContext(parent, 50*time.Millisecond)
+	defer done()
+
+	cancel()
+	if ctx.Err() != nil {
+		t.Fatal("drain context cancelled with its parent")
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain context outlived its grace period")
+	}
+
+	ctx, done = drainContext(context.Background(), time.Hour)
+	done()
+	if ctx.Err() == nil {
+		t.Fatal("done should release the drain context")
+	}
+}
+
+// selectFailAPI fails file selection for the listed torrent IDs.
+type selectFailAPI struct {
+	fakeAPI
+	fail     map[string]bool
+	selected []string
+}
+
+func (s *selectFailAPI) SelectFilesAll(_ context.Context, _ string, torrentID string) error {
+	if s.fail[torrentID] {
+		return errors.New("status=409 torrent not ready")
+	}
+	s.selected = append(s.selected, torrentID)
+	return nil
+}
+
+func TestRunOnceResumesStuckAdds(t *testing.T) {
+	api := &selectFailAPI{
+		fakeAPI: fakeAPI{
+			src: []rdapi.Torrent{
+				{ID: "1", Hash: "A", Filename: "Waiting"},
+				{ID: "2", Hash: "B", Filename: "Converting"},
+				{ID: "3", Hash: "C", Filename: "Done"},
+				{ID: "4", Hash: "D", Filename: "Broken"},
+			},
+			dst: []rdapi.Torrent{
+				{ID: "da", Hash: "a", Status: rdapi.StatusWaitingFiles},
+				{ID: "db", Hash: "b", Status: rdapi.StatusMagnetConversion},
+				{ID: "dc", Hash: "c", Status: "downloaded"},
+				{ID: "dd", Hash: "d", Status: rdapi.StatusWaitingFiles},
+				{ID: "dx", Hash: "x", Status: rdapi.StatusWaitingFiles}, // not mirrored
+			},
+		},
+		fail: map[string]bool{"db": true, "dd": true},
+	}
+	r := NewRunner(api, RunnerConfig{SrcToken: "src", DstToken: "dst", Mode: ModeAddOnly})
+
+	plan, _, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Resumes) != 3 || plan.Resumes[0].DestID != "da" || plan.Resumes[0].Reason != ReasonWaitingFiles {
+		t.Fatalf("unexpected resumes: %+v", plan.Resumes)
+	}
+
+	stats, err := r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	// The converting magnet is retried next run without counting as an error.
+	if stats.NeedResume != 3 || stats.Resumed != 1 || stats.AddErrors != 1 || stats.NeedAdd != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(api.selected) != 1 || api.selected[0] != "da" || len(api.added) != 0 {
+		t.Fatalf("selected %v, added %v", api.selected, api.added)
+	}
+}
+
+type fakeFailures struct {
+	held      map[string]string
+	failed    []string
+	succeeded []string
+}
+
+func (f *fakeFailures) Held(time.Time) (map[string]string, error) { return f.held, nil }
+
+func (f *fakeFailures) AddFailed(it PlanItem, _ error) error {
+	f.failed = append(f.failed, it.Hash)
+	return nil
+}
+
+func (f *fakeFailures) AddSucceeded(hash string) error {
+	f.succeeded = append(f.succeeded, hash)
+	return nil
+}
+
+// addFailAPI fails addMagnet for the listed hashes.
+type addFailAPI struct {
+	fakeAPI
+	fail map[string]bool
+}
+
+func (a *addFailAPI) AddMagnetByHash(ctx context.Context, token, hash string) (string, error) {
+	if a.fail[hash] {
+		return "", errors.New("status=451")
+	}
+	return a.fakeAPI.AddMagnetByHash(ctx, token, hash)
+}
+
+func TestRunOnceSkipsHeldAddsAndRecordsFailures(t *testing.T) {
+	api := &addFailAPI{
+		fakeAPI: fakeAPI{src: []rdapi.Torrent{
+			{ID: "1", Hash: "A"}, {ID: "2", Hash: "B"}, {ID: "3", Hash: "C"}, {ID: "4", Hash: "D"},
+		}},
+		fail: map[string]bool{"d": true},
+	}
+	tracker := &fakeFailures{held: map[string]string{"a": ReasonQuarantined, "b": ReasonFailureBackoff}}
+	r := NewRunner(api, RunnerConfig{SrcToken: "src", DstToken: "dst", Mode: ModeAddOnly, Failures: tracker})
+
+	stats, err := r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if stats.NeedAdd != 2 || stats.Added != 1 || stats.AddErrors != 1 || stats.Quarantined != 1 || stats.BackingOff != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(api.added) != 1 || api.added[0] != "c" {
+		t.Fatalf("added %v, want only c", api.added)
+	}
+	if len(tracker.failed) != 1 || tracker.failed[0] != "d" || len(tracker.succeeded) != 1 || tracker.succeeded[0] != "c" {
+		t.Fatalf("failed %v, succeeded %v", tracker.failed, tracker.succeeded)
+	}
+	skipped := map[string]string{}
+	for _, it := range r.LastPlan().Skipped {
+		skipped[it.Hash] = it.Reason
+	}
+	if skipped["a"] != ReasonQuarantined || skipped["b"] != ReasonFailureBackoff {
+		t.Fatalf("held adds should be listed as skipped: %+v", r.LastPlan().Skipped)
+	}
+}
+
+type fakeLists struct{ ignore, pin map[string]bool }
+
+func (f fakeLists) Load() (map[string]bool, map[string]bool, error) { return f.ignore, f.pin, nil }
+
+func TestRunOnceHonorsIgnoreAndPinLists(t *testing.T) {
+	api := &fakeAPI{
+		src: []rdapi.Torrent{{ID: "1", Hash: "A"}, {ID: "2", Hash: "B"}},
+		dst: []rdapi.Torrent{{ID: "d1", Hash: "C"}, {ID: "d2", Hash: "D"}},
+	}
+	r := NewRunner(api, RunnerConfig{
+		SrcToken: "src",
+		DstToken: "dst",
+		Mode:     ModeMirrorDelete,
+		Lists:    fakeLists{ignore: map[string]bool{"a": true}, pin: map[string]bool{"c": true}},
+	})
+
+	stats, err := r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if stats.Ignored != 1 || stats.Pinned != 1 || stats.Added != 1 || stats.Deleted != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(api.added) != 1 || api.added[0] != "b" || len(api.deleted) != 1 || api.deleted[0] != "d2" {
+		t.Fatalf("added %v, deleted %v", api.added, api.deleted)
+	}
+	plan := r.LastPlan()
+	if len(plan.Protected) != 1 || plan.Protected[0].Reason != ReasonPinned {
+		t.Fatalf("protected: %+v", plan.Protected)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].Reason != ReasonIgnored {
+		t.Fatalf("skipped: %+v", plan.Skipped)
+	}
+}
+
+// incompleteAPI lists the destination twice, as the client does after a
+// count mismatch, and reports the second listing incomplete too.
+type incompleteAPI struct {
+	fakeAPI
+	firstDst []rdapi.Torrent
+}
+
+func (a *incompleteAPI) ListTorrentPages(ctx context.Context, token string, reset func(), fn func([]rdapi.Torrent) error) error {
+	if token == "src" {
+		return a.fakeAPI.ListTorrentPages(ctx, token, reset, fn)
+	}
+	if err := fn(a.firstDst); err != nil {
+		return err
+	}
+	reset()
+	if err := a.fakeAPI.ListTorrentPages(ctx, token, reset, fn); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: saw 2 of 3 torrents", rdapi.ErrIncompleteListing)
+}
+
+func TestRunOnceIncompleteListingHoldsDeletes(t *testing.T) {
+	api := &incompleteAPI{
+		fakeAPI: fakeAPI{
+			src: []rdapi.Torrent{{ID: "1", Hash: "A"}, {ID: "2", Hash: "B"}},
+			dst: []rdapi.Torrent{{ID: "d2", Hash: "B"}, {ID: "d3", Hash: "C"}},
+		},
+		firstDst: []rdapi.Torrent{{ID: "d1", Hash: "A"}, {ID: "d9", Hash: "Z"}},
+	}
+	r := NewRunner(api, RunnerConfig{
+		SrcToken: "src",
+		DstToken: "dst",
+		Mode:     ModeMirrorDelete,
+	})
+
+	stats, err := r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if !stats.IncompleteListing || stats.DestCount != 2 || stats.NeedDelete != 0 || stats.Added != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(api.added) != 0 || len(api.deleted) != 0 {
+		t.Fatalf("added %v, deleted %v", api.added, api.deleted)
+	}
+	plan := r.LastPlan()
+	if len(plan.Skipped) != 2 || plan.Skipped[1].DestID != "d3" || plan.Skipped[1].Reason != ReasonIncompleteListing {
+		t.Fatalf("skipped: %+v", plan.Skipped)
+	}
+}
+
+func TestRunOnceIncompleteDestinationHoldsAddsAndDedupes(t *testing.T) {
+	api := &incompleteAPI{
+		fakeAPI: fakeAPI{
+			src: []rdapi.Torrent{{ID: "1", Hash: "A"}, {ID: "2", Hash: "B"}},
+			dst: []rdapi.Torrent{{ID: "d2", Hash: "B"}, {ID: "d3", Hash: "B"}},
+		},
+		firstDst: []rdapi.Torrent{{ID: "d1", Hash: "A"}},
+	}
+	r := NewRunner(api, RunnerConfig{
+		SrcToken: "src",
+		DstToken: "dst",
+		Mode:     ModeAddOnly,
+		Dedupe:   true,
+	})
+
+	stats, err := r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if !stats.IncompleteListing || stats.NeedAdd != 0 || stats.Added != 0 || stats.Deduped != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(api.added) != 0 || len(api.deleted) != 0 {
+		t.Fatalf("added %v, deleted %v", api.added, api.deleted)
+	}
+	plan := r.LastPlan()
+	if len(plan.Adds) != 0 || len(plan.Dedupes) != 0 {
+		t.Fatalf("adds %+v, dedupes %+v", plan.Adds, plan.Dedupes)
+	}
+	if len(plan.Skipped) != 2 || plan.Skipped[0].SourceID != "1" || plan.Skipped[1].DestID != "d3" {
+		t.Fatalf("skipped: %+v", plan.Skipped)
+	}
+	for _, it := range plan.Skipped {
+		if it.Reason != ReasonIncompleteListing {
+			t.Fatalf("skipped reason %q, want %q", it.Reason, ReasonIncompleteListing)
+		}
+	}
+}
+
+// countingAPI counts destination listings and can fail deletes.
+type countingAPI struct {
+	fakeAPI
+	dstListings int
+	failDeletes bool
+}
+
+func (a *countingAPI) ListTorrentPages(ctx context.Context, token string, reset func(), fn func([]rdapi.Torrent) error) error {
+	if token != "src" {
+		a.dstListings++
+	}
+	return a.fakeAPI.ListTorrentPages(ctx, token, reset, fn)
+}
+
+func (a *countingAPI) DeleteTorrent(ctx context.Context, token, torrentID string) error {
+	if a.failDeletes {
+		return errors.New("status=503")
+	}
+	return a.fakeAPI.DeleteTorrent(ctx, token, torrentID)
+}
+
+func TestRunOncePlansFromDestModel(t *testing.T) {
+	api := &countingAPI{fakeAPI: fakeAPI{
+		src: []rdapi.Torrent{{ID: "1", Hash: "A"}, {ID: "2", Hash: "B"}},
+		dst: []rdapi.Torrent{{ID: "d2", Hash: "B"}, {ID: "d3", Hash: "C"}},
+	}}
+	r := NewRunner(api, RunnerConfig{
+		SrcToken:      "src",
+		DstToken:      "dst",
+		Mode:          ModeMirrorDelete,
+		FullReconcile: time.Hour,
+	})
+
+	stats, err := r.RunOnce(context.Background())
+	if err != nil || stats.DestCached || stats.Added != 1 || stats.Deleted != 1 {
+		t.Fatalf("first run: stats %+v, err %v", stats, err)
+	}
+
+	// The second run trusts its own add and delete instead of listing.
+	stats, err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if !stats.DestCached || stats.DestCount != 2 || stats.NeedAdd != 0 || stats.NeedDelete != 0 || api.dstListings != 1 {
+		t.Fatalf("second run: stats %+v, %d destination listings", stats, api.dstListings)
+	}
+
+	// A failed delete makes the model suspect, so the run after it lists.
+	api.src = api.src[:1]
+	api.failDeletes = true
+	stats, err = r.RunOnce(context.Background())
+	if err != nil || !stats.DestCached || stats.DeleteErrors != 1 {
+		t.Fatalf("third run: stats %+v, err %v", stats, err)
+	}
+	stats, err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("fourth run failed: %v", err)
+	}
+	if stats.DestCached || api.dstListings != 2 {
+		t.Fatalf("fourth run: stats %+v, %d destination listings", stats, api.dstListings)
+	}
+}
+
+func TestRunOnceDedupesDestination(t *testing.T) {
+	api := &fakeAPI{
+		src: []rdapi.Torrent{{ID: "1", Hash: "A"}, {ID: "2", Hash: "B"}},
+		dst: []rdapi.Torrent{
+			{ID: "a1", Hash: "A", Status: "downloaded", Added: "2024-02-01T00:00:00.000Z"},
+			{ID: "a2", Hash: "A", Status: "downloaded", Added: "2024-01-01T00:00:00.000Z"},
+			{ID: "a3", Hash: "A", Status: "magnet_error", Added: "2023-01-01T00:00:00.000Z"},
+			{ID: "b1", Hash: "B", Status: "downloaded"},
+			{ID: "c1", Hash: "C", Status: "downloaded"},
+			{ID: "c2", Hash: "C", Status: "downloaded"},
+		},
+	}
+	r := NewRunner(api, RunnerConfig{
+		SrcToken:      "src",
+		DstToken:      "dst",
+		Mode:          ModeMirrorDelete,
+		Dedupe:        true,
+		FullReconcile: time.Hour,
+	})
+
+	stats, err := r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if stats.Duplicates != 3 || stats.Deduped != 2 || stats.Deleted != 2 || stats.NeedDelete != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	// The oldest of the healthy copies of A is kept, and both copies of C,
+	// which is not in the source, are deleted.
+	if got := strings.Join(api.deleted, ","); got != "c1,c2,a1,a3" {
+		t.Fatalf("deleted %s, want c1,c2,a1,a3", got)
+	}
+	plan := r.LastPlan()
+	if len(plan.Dedupes) != 2 || plan.Dedupes[0].Reason != ReasonDuplicate {
+		t.Fatalf("dedupes: %+v", plan.Dedupes)
+	}
+
+	stats, err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if !stats.DestCached || stats.Duplicates != 0 || stats.DestCount != 2 || len(api.deleted) != 4 {
+		t.Fatalf("second run: stats %+v, deleted %v", stats, api.deleted)
+	}
+}
+
+func TestPlanListsDuplicatesWithoutDedupe(t *testing.T) {
+	api := &fakeAPI{
+		src: []rdapi.Torrent{{ID: "1", Hash: "A"}},
+		dst: []rdapi.Torrent{{ID: "a1", Hash: "A"}, {ID: "a2", Hash: "A"}},
+	}
+	r := NewRunner(api, RunnerConfig{SrcToken: "src", DstToken: "dst", Mode: ModeAddOnly})
+
+	stats, err := r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if stats.Duplicates != 1 || stats.Deduped != 0 || len(api.deleted) != 0 {
+		t.Fatalf("stats %+v, deleted %v", stats, api.deleted)
+	}
+	plan := r.LastPlan()
+	if len(plan.Dedupes) != 0 || len(plan.Skipped) != 1 || plan.Skipped[0].DestID != "a2" || plan.Skipped[0].Reason != ReasonDuplicate {
+		t.Fatalf("dedupes %+v, skipped %+v", plan.Dedupes, plan.Skipped)
+	}
+}
+
+// BenchmarkPlan100k plans a mirror of a 100k-torrent library onto a
+// destination that already has all but 1% of it and 1k torrents of its own.
+func BenchmarkPlan100k(b *testing.B) {
+	const n = 100_000
+	api := &fakeAPI{src: make([]rdapi.Torrent, 0, n), dst: make([]rdapi.Torrent, 0, n), pageSize: 2500}
+	for i := 0; i < n; i++ {
+		h := fmt.Sprintf("%040x", i)
+		api.src = append(api.src, rdapi.Torrent{ID: "s" + h[32:], Hash: h, Filename: "torrent " + h[32:], Status: "downloaded"})
+		if i%100 != 0 {
+			api.dst = append(api.dst, rdapi.Torrent{ID: "d" + h[32:], Hash: h, Filename: "torrent " + h[32:], Status: "downloaded"})
+		}
+	}
+	for i := 0; i < n/100; i++ {
+		h := fmt.Sprintf("%040x", n+i)
+		api.dst = append(api.dst, rdapi.Torrent{ID: "x" + h[32:], Hash: h, Filename: "extra " + h[32:], Status: "downloaded"})
+	}
+	r := NewRunner(api, RunnerConfig{
+		Name: "bench", Mode: ModeMirrorDelete, SrcToken: "src", DstToken: "dst",
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		plan, _, err := r.Plan(context.Background())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(plan.Adds) != n/100 || len(plan.Deletes) != n/100 {
+			b.Fatalf("got %d adds and %d deletes, want %d of each", len(plan.Adds), len(plan.Deletes), n/100)
+		}
+	}
+}
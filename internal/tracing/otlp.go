@@ -0,0 +1,189 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding.
+type OTLPExporter struct {
+	url      string
+	headers  map[string]string
+	resource []Attr
+	client   *http.Client
+}
+
+// NewOTLPExporter returns an exporter posting to endpoint. An endpoint
+// without a path, like "http://localhost:4318", gets the standard
+// "/v1/traces" appended. headers are sent with every request, e.g. for an
+// API key. resource attributes (such as service.name) describe this process.
+func NewOTLPExporter(endpoint string, headers map[string]string, resource ...Attr) (*OTLPExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("otlp endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("otlp endpoint %q: scheme must be http or https", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return &OTLPExporter{
+		url:      u.String(),
+		headers:  headers,
+		resource: resource,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(spans, e.resource))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: status=%d %s", e.url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// ParseHeaders parses the OTEL_EXPORTER_OTLP_HEADERS format,
+// "key1=value1,key2=value2", with URL-encoded values.
+func ParseHeaders(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid header %q (expected key=value)", kv)
+		}
+		if dv, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = dv
+		}
+		out[k] = strings.TrimSpace(v)
+	}
+	return out, nil
+}
+
+// The types below are the OTLP/JSON encoding of ExportTraceServiceRequest.
+// IDs are hex strings and 64-bit integers are decimal strings.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 unset, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func otlpRequest(spans []SpanData, resource []Attr) otlpTraces {
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		sp := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttrs(s.Attrs),
+		}
+		if !s.ParentID.IsZero() {
+			sp.ParentSpanID = s.ParentID.String()
+		}
+		if s.Err != "" {
+			sp.Status = otlpStatus{Code: 2, Message: s.Err}
+		}
+		out[i] = sp
+	}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttrs(resource)},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "rd-mirror-sync"}, Spans: out}},
+	}}}
+}
+
+func otlpAttrs(attrs []Attr) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v map[string]any
+		switch x := a.Value.(type) {
+		case string:
+			v = map[string]any{"stringValue": x}
+		case int64:
+			v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+		case int:
+			v = map[string]any{"intValue": strconv.Itoa(x)}
+		case float64:
+			v = map[string]any{"doubleValue": x}
+		case bool:
+			v = map[string]any{"boolValue": x}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(x)}
+		}
+		out = append(out, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return out
+}
@@ -0,0 +1,279 @@
+// Package tracing records spans for sync runs and API calls and exports them
+// in batches, over OTLP/HTTP or to memory for tests. It implements the small
+// subset of OpenTelemetry tracing rd-mirror-sync needs without dependencies.
+//
+// A nil *Tracer is valid and records nothing, so callers can trace
+// unconditionally.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+
+	"rdmirrorsync/internal/logging"
+)
+
+const (
+	flushInterval = 5 * time.Second
+	maxBatch      = 512
+	maxQueue      = 4096
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+func (id SpanID) IsZero() bool    { return id == SpanID{} }
+
+// Attr is a span attribute. Value is a string, int, int64, float64 or bool.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(k, v string) Attr        { return Attr{k, v} }
+func Int(k string, v int) Attr       { return Attr{k, int64(v)} }
+func Bool(k string, v bool) Attr     { return Attr{k, v} }
+func Float(k string, v float64) Attr { return Attr{k, v} }
+
+// Kind mirrors the OTLP span kinds used here.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindClient   Kind = 3
+)
+
+// SpanData is a finished span as handed to an Exporter.
+type SpanData struct {
+	TraceID  TraceID
+	SpanID   SpanID
+	ParentID SpanID
+	Name     string
+	Kind     Kind
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	// Err is the status message of a failed span; empty means OK/unset.
+	Err string
+}
+
+// Attr returns the value of the attribute named key, or nil.
+func (s SpanData) Attr(key string) any {
+	for _, a := range s.Attrs {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// Exporter sends finished spans somewhere.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+}
+
+// Tracer creates spans and batches finished ones to its Exporter.
+type Tracer struct {
+	exp Exporter
+
+	mu      sync.Mutex
+	pending []SpanData
+	dropped int
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewTracer returns a Tracer exporting to exp every few seconds, or sooner
+// once a batch fills. Call Shutdown to flush what is left.
+func NewTracer(exp Exporter) *Tracer {
+	t := &Tracer{
+		exp:  exp,
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+func (t *Tracer) loop() {
+	defer close(t.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		case <-t.kick:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := t.Flush(ctx); err != nil {
+			slog.Warn("trace export failed", logging.Err(err))
+		}
+		cancel()
+	}
+}
+
+// Flush exports all finished spans now.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = nil
+	dropped := t.dropped
+	t.dropped = 0
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		slog.Warn("trace queue full; spans dropped", "dropped", dropped)
+	}
+	for len(batch) > 0 {
+		n := min(len(batch), maxBatch)
+		if err := t.exp.ExportSpans(ctx, batch[:n]); err != nil {
+			return err
+		}
+		batch = batch[n:]
+	}
+	return nil
+}
+
+// Shutdown stops the background exporter and flushes remaining spans.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.once.Do(func() { close(t.stop) })
+	<-t.done
+	return t.Flush(ctx)
+}
+
+func (t *Tracer) finish(s SpanData) {
+	t.mu.Lock()
+	full := false
+	if len(t.pending) >= maxQueue {
+		t.dropped++
+	} else {
+		t.pending = append(t.pending, s)
+		full = len(t.pending) >= maxBatch
+	}
+	t.mu.Unlock()
+	if full {
+		select {
+		case t.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+type spanKey struct{}
+
+// Start begins a span named name, a child of the span in ctx if any, and
+// returns a context carrying it. End must be called on the returned span.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return t.StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind is Start with an explicit span kind.
+func (t *Tracer) StartKind(ctx context.Context, name string, kind Kind, attrs ...Attr) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{tracer: t, data: SpanData{
+		SpanID: newSpanID(),
+		Name:   name,
+		Kind:   kind,
+		Start:  time.Now(),
+		Attrs:  append([]Attr(nil), attrs...),
+	}}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		s.data.TraceID = parent.data.TraceID
+		s.data.ParentID = parent.data.SpanID
+	} else {
+		s.data.TraceID = newTraceID()
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Span is an in-progress span. Its methods are safe on a nil *Span and
+// must be called from one goroutine.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+	ended  bool
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.data.Attrs = append(s.data.Attrs, attrs...)
+}
+
+// RecordError marks the span failed with err. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.data.Err = err.Error()
+}
+
+// End finishes the span and queues it for export. Later calls are no-ops.
+func (s *Span) End() {
+	if s == nil || s.ended {
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.tracer.finish(s.data)
+}
+
+func newTraceID() (id TraceID) {
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// MemoryExporter keeps exported spans in memory, for tests.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *MemoryExporter) ExportSpans(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (e *MemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpansNestAndExport(t *testing.T) {
+	exp := &MemoryExporter{}
+	tr := NewTracer(exp)
+
+	ctx, root := tr.Start(context.Background(), "root", String("dest", "a"))
+	_, child := tr.Start(ctx, "child")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End() // no-op
+	root.End()
+
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if c.Name != "child" || r.Name != "root" {
+		t.Fatalf("unexpected order: %s, %s", c.Name, r.Name)
+	}
+	if c.TraceID != r.TraceID || c.ParentID != r.SpanID || !r.ParentID.IsZero() {
+		t.Fatalf("child not parented to root: %+v %+v", c, r)
+	}
+	if c.Err != "boom" || r.Err != "" {
+		t.Fatalf("unexpected status: child=%q root=%q", c.Err, r.Err)
+	}
+	if r.Attr("dest") != "a" {
+		t.Fatalf("dest attribute: got %v", r.Attr("dest"))
+	}
+}
+
+func TestNilTracerIsNoop(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "x")
+	span.SetAttributes(Int("n", 1))
+	span.RecordError(errors.New("x"))
+	span.End()
+	if SpanFromContext(ctx) != nil {
+		t.Fatal("nil tracer should not put a span in the context")
+	}
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOTLPExporterPostsJSON(t *testing.T) {
+	var got otlpTraces
+	var path, apiKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, apiKey = r.URL.Path, r.Header.Get("X-Api-Key")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	exp, err := NewOTLPExporter(srv.URL, map[string]string{"X-Api-Key": "k"}, String("service.name", "svc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTracer(exp)
+	ctx, root := tr.Start(context.Background(), "root", Int("n", 3))
+	_, child := tr.StartKind(ctx, "GET /torrents", KindClient)
+	child.RecordError(errors.New("status=503"))
+	child.End()
+	root.End()
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if path != "/v1/traces" || apiKey != "k" {
+		t.Fatalf("path=%q api key=%q", path, apiKey)
+	}
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected payload: %+v", got)
+	}
+	if a := got.ResourceSpans[0].Resource.Attributes; len(a) != 1 || a[0].Value["stringValue"] != "svc" {
+		t.Fatalf("resource attributes: %+v", a)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if c.ParentSpanID != r.SpanID || c.TraceID != r.TraceID || len(r.TraceID) != 32 || len(r.SpanID) != 16 {
+		t.Fatalf("bad ids: child=%+v root=%+v", c, r)
+	}
+	if c.Kind != int(KindClient) || c.Status.Code != 2 || c.Status.Message != "status=503" {
+		t.Fatalf("child span: %+v", c)
+	}
+	if r.Attributes[0].Value["intValue"] != "3" {
+		t.Fatalf("int attribute: %+v", r.Attributes)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	h, err := ParseHeaders("api-key=abc%3D, x-team = ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h["api-key"] != "abc=" || h["x-team"] != "ops" {
+		t.Fatalf("got %v", h)
+	}
+	if _, err := ParseHeaders("novalue"); err == nil {
+		t.Fatal("expected error for header without '='")
+	}
+}